@@ -3,7 +3,11 @@ module easybtrf5
 go 1.24.2
 
 require (
-	github.com/jroimartin/gocui v0.5.0 // indirect
+	github.com/jroimartin/gocui v0.5.0
+	golang.org/x/sys v0.41.0
+)
+
+require (
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/nsf/termbox-go v1.1.1 // indirect
 )
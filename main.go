@@ -1,21 +1,235 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"easybtrf5/ui"
 )
 
+// mounts holds temporary top-level subvolume mounts created at startup
+var mounts ui.TopLevelMounts
+
+func usage() {
+	fmt.Println("Usage: easybtrf5 [--theme default|high-contrast|monochrome] [<path, device or UUID of btrfs partition>...]")
+	fmt.Println("       easybtrf5 health <path to btrfs partition>")
+	fmt.Println("       easybtrf5 exporter [--listen " + ui.DefaultExporterListen + "] <path to btrfs partition>")
+	fmt.Println("       easybtrf5 snapshot-all [--tag <tag>] <path to btrfs partition>")
+	os.Exit(1)
+}
+
+// resolvePaths resolves every target to a mounted top-level subvolume
+func resolvePaths(targets []string) ([]string, error) {
+	paths := make([]string, 0, len(targets))
+	for _, target := range targets {
+		path, err := mounts.Resolve(target)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// checkTargets checks that butterfs runs as root and resolves every target to a mounted
+// top-level subvolume, so all commands fail the same way before touching a filesystem
+func checkTargets(targets []string) ([]string, error) {
+	if err := ui.CheckRoot(); err != nil {
+		return nil, err
+	}
+	paths, err := resolvePaths(targets)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if err := ui.ValidateTopLevel(path); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// interrupt is closed when the TUI should quit because of a termination signal
+var interrupt = make(chan struct{})
+
+// tuiRunning is set while the TUI owns the terminal
+var tuiRunning atomic.Bool
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: easybtrf5 <path to btrfs partition>")
+	// A signal makes the TUI quit so the terminal is restored and the deferred log
+	// closers and mount cleanup of run take over. Without the TUI, or on a second
+	// signal, temporary mounts are unmounted right away.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		if tuiRunning.Load() {
+			close(interrupt)
+			<-signals
+		}
+		mounts.Cleanup()
 		os.Exit(1)
+	}()
+
+	code := run()
+	mounts.Cleanup()
+	os.Exit(code)
+}
+
+// run executes the requested command and returns the process exit code
+func run() int {
+	// Deferred cleanup also runs when the UI panics
+	defer mounts.Cleanup()
+
+	if len(os.Args) > 1 && os.Args[1] == "health" {
+		if len(os.Args) != 3 {
+			usage()
+		}
+		paths, err := checkTargets(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		healthy, err := ui.CheckHealth(os.Stdout, paths[0])
+		if err != nil {
+			// Distinguish failure to read counters from unhealthy devices
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if !healthy {
+			return 1
+		}
+		return 0
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "exporter" {
+		flags := flag.NewFlagSet("exporter", flag.ExitOnError)
+		listen := flags.String("listen", ui.DefaultExporterListen, "address to serve metrics on")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			usage()
+		}
+		paths, err := checkTargets(flags.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		ui.SetupPrefixes()
+		if err := ui.SetupOptions(); err != nil {
+			log.Print(err)
+			return 1
+		}
+		if err := ui.RunExporter(*listen, paths[0]); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "snapshot-all" {
+		flags := flag.NewFlagSet("snapshot-all", flag.ExitOnError)
+		tag := flags.String("tag", "", "tag appended to the snapshot names and saved as their description")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			usage()
+		}
+		paths, err := checkTargets(flags.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		ui.SetupPrefixes()
+		if err := ui.SetupOptions(); err != nil {
+			log.Print(err)
+			return 1
+		}
+		closeLog, err := ui.OpenLogs()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer closeLog()
+		all, _, err := ui.GetBtrfsSubvolumes(paths[0])
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		subvolumes := ui.TopSubvolumes(all)
+		if len(subvolumes) == 0 {
+			log.Print("no subvolumes to snapshot")
+			return 1
+		}
+		// All snapshots share one timestamp so they form a group
+		created, err := ui.SnapshotAll(paths[0], subvolumes, time.Now(), *tag)
+		for _, name := range created {
+			fmt.Println(name)
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	flags := flag.NewFlagSet("easybtrf5", flag.ExitOnError)
+	flags.Usage = usage
+	themeName := flags.String("theme", "", "color theme: default, high-contrast or monochrome")
+	flags.Parse(os.Args[1:])
+
+	targets := flags.Args()
+	if len(targets) == 0 {
+		// Monitor all mounted Btrfs filesystems when no path is given
+		discovered, err := ui.DiscoverBtrfs()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if len(discovered) == 0 {
+			usage()
+		}
+		targets = discovered
+	}
+
+	// Check everything the TUI needs before gocui takes over the terminal
+	paths, err := checkTargets(targets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
 
 	ui.SetupPrefixes()
-	if err := ui.Run(os.Args[1]); err != nil {
-		log.Fatal(err)
+	if err := ui.SetupOptions(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// The flag takes precedence over NO_COLOR and the configuration file
+	if *themeName != "" {
+		if err := ui.SetTheme(*themeName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	closeLog, err := ui.OpenLogs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeLog()
+	tuiRunning.Store(true)
+	if err := ui.Run(interrupt, paths...); err != nil {
+		log.Print(err)
+		return 1
+	}
+	select {
+	case <-interrupt:
+		return 1
+	default:
+		return 0
 	}
 }
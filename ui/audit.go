@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/syslog"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAuditLog is the audit trail of destructive operations unless configured otherwise
+const DefaultAuditLog = "/var/log/butterfs-audit.log"
+
+// maxHistoryEntries limits the audit entries shown in the history pane
+const maxHistoryEntries = 500
+
+var (
+	// auditLogPath is the audit trail file, empty if disabled with "audit = none"
+	auditLogPath = DefaultAuditLog
+	// auditSyslog also sends audit entries to syslog, and so to journald
+	auditSyslog = false
+)
+
+// auditLog holds the open audit destinations, nil until OpenLogs is called
+var (
+	auditLog    *os.File
+	auditWriter *syslog.Writer
+	auditMu     sync.Mutex
+	// auditHook is called after each entry is recorded, e.g. to redraw the history pane
+	auditHook func()
+)
+
+// openAuditLog opens the audit trail for appending
+func openAuditLog() error {
+	if auditLogPath != "" {
+		file, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %v\nSet \"audit = none\" in the configuration file to disable it", err)
+		}
+		auditLog = file
+	}
+	if auditSyslog {
+		writer, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "butterfs")
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %v", err)
+		}
+		auditWriter = writer
+	}
+	return nil
+}
+
+// closeAuditLog closes the audit destinations
+func closeAuditLog() {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditLog != nil {
+		auditLog.Close()
+		auditLog = nil
+	}
+	if auditWriter != nil {
+		auditWriter.Close()
+		auditWriter = nil
+	}
+}
+
+// auditUser returns the user who started butterfs, the sudo caller rather than root
+func auditUser() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return fmt.Sprintf("uid:%d", os.Getuid())
+}
+
+// audit records a destructive operation, e.g. audit("delete", "/mnt/_snapshots/rootvol-20250525-112410", err)
+func audit(action string, target string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed: " + err.Error()
+	}
+	entry := fmt.Sprintf("user=%s action=%s target=%q result=%q", auditUser(), action, target, result)
+
+	auditMu.Lock()
+	if auditLog != nil {
+		fmt.Fprintf(auditLog, "%s %s\n", time.Now().Format(time.RFC3339), entry)
+	}
+	if auditWriter != nil {
+		// syslog adds its own timestamp
+		auditWriter.Notice(entry)
+	}
+	hook := auditHook
+	auditMu.Unlock()
+
+	if hook != nil {
+		hook()
+	}
+}
+
+// AuditHistory returns the latest entries of the audit trail, newest first
+func AuditHistory() ([]string, error) {
+	if auditLogPath == "" {
+		return nil, fmt.Errorf("the audit log is disabled")
+	}
+	file, err := os.Open(auditLogPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend performs subvolume operations on a Btrfs filesystem
+type Backend interface {
+	// ListSubvolumes returns all subvolumes with paths relative to the top-level subvolume
+	ListSubvolumes(path string) ([]Subvolume, error)
+	// SubvolumeInfo returns human-readable information about a subvolume
+	SubvolumeInfo(path string) (string, error)
+	// CreateSnapshot creates a snapshot of subvolumePath at snapshotPath
+	CreateSnapshot(subvolumePath string, snapshotPath string) error
+	// DeleteSnapshot deletes a snapshot
+	DeleteSnapshot(snapshotPath string) error
+	// DeleteSnapshots deletes several snapshots and returns per-snapshot results
+	DeleteSnapshots(snapshotPaths []string) []DeleteResult
+}
+
+// DeleteResult is the outcome of deleting one snapshot in a batch
+type DeleteResult struct {
+	Path string
+	Err  error
+}
+
+// backend is used for all subvolume operations
+var backend Backend = execBackend{}
+
+// SetBackend selects the backend by name, "exec" for btrfs-progs or "ioctl" for native ioctls
+func SetBackend(name string) error {
+	switch strings.ToLower(name) {
+	case "exec":
+		backend = execBackend{}
+	case "ioctl":
+		backend = ioctlBackend{}
+	default:
+		return fmt.Errorf("unknown backend %q, expected exec or ioctl", name)
+	}
+	return nil
+}
+
+// ListSubvolumes returns all subvolumes of the filesystem at path
+func ListSubvolumes(path string) ([]Subvolume, error) {
+	return backend.ListSubvolumes(path)
+}
+
+// GetBtrfsSnapshotInfo returns snapshot information
+func GetBtrfsSnapshotInfo(snapshotPath string) (string, error) {
+	return backend.SubvolumeInfo(snapshotPath)
+}
+
+// CreateSnapshot creates a new snapshot for the specified subvolume
+func CreateSnapshot(subvolumePath string, snapshotPath string) error {
+	err := backend.CreateSnapshot(subvolumePath, snapshotPath)
+	logOperation(fmt.Sprintf("create snapshot %s of %s", snapshotPath, subvolumePath), err)
+	audit("create", snapshotPath, err)
+	return err
+}
+
+// DeleteSnapshot deletes the specified snapshot
+func DeleteSnapshot(snapshotPath string) error {
+	err := backend.DeleteSnapshot(snapshotPath)
+	logOperation("delete snapshot "+snapshotPath, err)
+	audit("delete", snapshotPath, err)
+	return err
+}
+
+// DeleteSnapshots deletes several snapshots and returns per-snapshot results
+func DeleteSnapshots(snapshotPaths []string) []DeleteResult {
+	results := backend.DeleteSnapshots(snapshotPaths)
+	for _, result := range results {
+		logOperation("delete snapshot "+result.Path, result.Err)
+		audit("delete", result.Path, result.Err)
+	}
+	return results
+}
@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// raidProfile describes redundancy requirements of a block group profile
+type raidProfile struct {
+	minDevices int
+	// copies is the number of full copies, parity profiles use zero
+	copies int
+	// parity is the number of parity stripes for raid5/raid6
+	parity int
+}
+
+// raidProfiles lists profiles accepted by 'btrfs balance start -dconvert/-mconvert'
+var raidProfiles = map[string]raidProfile{
+	"single":  {minDevices: 1, copies: 1},
+	"dup":     {minDevices: 1, copies: 2},
+	"raid0":   {minDevices: 2, copies: 1},
+	"raid1":   {minDevices: 2, copies: 2},
+	"raid1c3": {minDevices: 3, copies: 3},
+	"raid1c4": {minDevices: 4, copies: 4},
+	"raid10":  {minDevices: 4, copies: 2},
+	"raid5":   {minDevices: 2, parity: 1},
+	"raid6":   {minDevices: 3, parity: 2},
+}
+
+// RaidProfileNames returns names of supported profiles in a stable order
+func RaidProfileNames() []string {
+	names := make([]string, 0, len(raidProfiles))
+	for name := range raidProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redundant reports whether a profile keeps a second copy or parity of its data
+func (p raidProfile) redundant() bool {
+	return p.copies >= 2 || p.parity > 0
+}
+
+// ratio returns raw bytes consumed per logical byte on the given number of devices
+func (p raidProfile) ratio(devices int) float64 {
+	if p.parity > 0 {
+		return float64(devices) / float64(devices-p.parity)
+	}
+	return float64(p.copies)
+}
+
+// capacity approximates logical bytes a profile can store on devices of the given sizes
+func (p raidProfile) capacity(sizes []uint64) uint64 {
+	var total, largest uint64
+	for _, size := range sizes {
+		total += size
+		if size > largest {
+			largest = size
+		}
+	}
+	copies := p.copies
+	if p.parity > 0 || copies == 1 || len(sizes) == 1 {
+		return uint64(float64(total) / p.ratio(len(sizes)))
+	}
+	// Each copy must live on a different device, so the largest device can only
+	// hold as much as the other devices can mirror
+	capacity := total / uint64(copies)
+	if limit := (total - largest) / uint64(copies-1); limit < capacity {
+		capacity = limit
+	}
+	return capacity
+}
+
+// ConversionPlan describes a requested profile conversion and its feasibility
+type ConversionPlan struct {
+	DataFrom     string
+	DataTo       string
+	MetadataFrom string
+	MetadataTo   string
+	// Required and Available are logical bytes needed and storable after conversion
+	Required  uint64
+	Available uint64
+	Problems  []string
+}
+
+// Feasible reports whether no problems were found for the conversion
+func (p *ConversionPlan) Feasible() bool {
+	return len(p.Problems) == 0
+}
+
+// ReducesMetadataRedundancy reports whether redundant metadata is converted to a profile
+// without redundancy like single or raid0, which btrfs refuses without -f
+func (p *ConversionPlan) ReducesMetadataRedundancy() bool {
+	return raidProfiles[p.MetadataFrom].redundant() && !raidProfiles[p.MetadataTo].redundant()
+}
+
+// PlanConversion checks device count and free space for converting data and
+// metadata profiles. An empty target keeps the current profile.
+func PlanConversion(usage *FilesystemUsage, devices []Device, dataTo string, metadataTo string) *ConversionPlan {
+	plan := &ConversionPlan{}
+	var dataUsed, metadataUsed uint64
+	for _, group := range usage.BlockGroups {
+		switch group.Type {
+		case "Data":
+			plan.DataFrom = strings.ToLower(group.Profile)
+			dataUsed += group.Used
+		case "Metadata":
+			plan.MetadataFrom = strings.ToLower(group.Profile)
+			metadataUsed += group.Used
+		}
+	}
+	plan.DataTo = strings.ToLower(dataTo)
+	if plan.DataTo == "" {
+		plan.DataTo = plan.DataFrom
+	}
+	plan.MetadataTo = strings.ToLower(metadataTo)
+	if plan.MetadataTo == "" {
+		plan.MetadataTo = plan.MetadataFrom
+	}
+
+	sizes := make([]uint64, 0, len(devices))
+	for _, device := range devices {
+		sizes = append(sizes, device.Size)
+	}
+
+	for _, target := range []string{plan.DataTo, plan.MetadataTo} {
+		profile, found := raidProfiles[target]
+		if !found {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("unknown profile %q", target))
+			continue
+		}
+		if len(devices) < profile.minDevices {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("%s needs at least %d devices, filesystem has %d",
+				target, profile.minDevices, len(devices)))
+		}
+	}
+	if !plan.Feasible() {
+		return plan
+	}
+
+	// Compare raw space needed by both profiles against total device size
+	dataProfile := raidProfiles[plan.DataTo]
+	metadataProfile := raidProfiles[plan.MetadataTo]
+	plan.Required = dataUsed + metadataUsed
+	plan.Available = dataProfile.capacity(sizes)
+	rawRequired := float64(dataUsed)*dataProfile.ratio(len(sizes)) + float64(metadataUsed)*metadataProfile.ratio(len(sizes))
+	if plan.Required > plan.Available || rawRequired > float64(usage.DeviceSize) {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("not enough space: %s used, about %s available as %s",
+			formatBytes(plan.Required), formatBytes(plan.Available), plan.DataTo))
+	}
+	if plan.DataTo == plan.DataFrom && plan.MetadataTo == plan.MetadataFrom {
+		plan.Problems = append(plan.Problems, "profiles are already "+plan.DataTo+"/"+plan.MetadataTo)
+	}
+	return plan
+}
+
+// StartConversion starts a background balance converting data and metadata profiles
+// as planned. Only profiles that change are passed, a reduction of metadata
+// redundancy is forced.
+func StartConversion(path string, plan *ConversionPlan) (err error) {
+	defer func() {
+		logOperation(fmt.Sprintf("convert profiles of %s to data %s, metadata %s", path, plan.DataTo, plan.MetadataTo), err)
+		audit("convert", path, err)
+	}()
+
+	args := []string{"balance", "start", "--bg"}
+	if plan.ReducesMetadataRedundancy() {
+		args = append(args, "-f")
+	}
+	if plan.DataTo != plan.DataFrom {
+		args = append(args, "-dconvert="+plan.DataTo)
+	}
+	if plan.MetadataTo != plan.MetadataFrom {
+		args = append(args, "-mconvert="+plan.MetadataTo)
+	}
+	if output, err := runner.CombinedOutput("btrfs", append(args, path)...); err != nil {
+		return fmt.Errorf("failed to start balance: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetBalanceStatus executes 'btrfs balance status' command and returns progress text
+// and whether a balance is running
+func GetBalanceStatus(path string) (string, bool, error) {
+	output, err := runner.Output("btrfs", "balance", "status", path)
+	// Exit code 1 means a balance is running, so rely on the output text instead
+	if err != nil && len(output) == 0 {
+		return "", false, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) == 0 || !strings.Contains(lines[0], "running") && !strings.Contains(lines[0], "paused") {
+		return "", false, nil
+	}
+	for _, line := range lines[1:] {
+		if strings.Contains(line, "chunks balanced") {
+			return strings.Join(strings.Fields(line), " "), true, nil
+		}
+	}
+	return strings.TrimSpace(lines[0]), true, nil
+}
@@ -2,76 +2,118 @@ package ui
 
 import (
 	"fmt"
-	"os/exec"
+	"os"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 var (
 	subvolumePrefix = "_active"
 	snapshotPrefix  = "_snapshots"
+	// commitAfterDelete makes snapshot deletion wait for the transaction commit
+	commitAfterDelete = false
 )
 
-// GetBtrfsSubvolumes executes 'btrfs subvolume list' command and returns filtered results
-func GetBtrfsSubvolumes(path string) (subvolumes []string, snapshots []string, err error) {
-	cmd := exec.Command("btrfs", "subvolume", "list", path)
-	output, err := cmd.Output()
+// execBackend implements Backend by running btrfs-progs
+type execBackend struct{}
+
+// Subvolume describes one entry of 'btrfs subvolume list' output
+type Subvolume struct {
+	ID       uint64
+	Gen      uint64
+	TopLevel uint64
+	Path     string
+}
+
+// ListSubvolumes executes 'btrfs subvolume list' command and returns all subvolumes
+func (execBackend) ListSubvolumes(path string) ([]Subvolume, error) {
+	output, err := runner.Output("btrfs", "subvolume", "list", path)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	return parseSubvolumeList(string(output)), nil
+}
+
+// ListDeletedSubvolumes executes 'btrfs subvolume list -d' command and returns
+// deleted subvolumes not yet cleaned up
+func ListDeletedSubvolumes(path string) ([]Subvolume, error) {
+	output, err := runner.Output("btrfs", "subvolume", "list", "-d", path)
+	if err != nil {
+		return nil, err
 	}
+	return parseSubvolumeList(string(output)), nil
+}
 
-	lines := strings.Split(string(output), "\n")
+// parseSubvolumeList parses output of 'btrfs subvolume list'
+func parseSubvolumeList(output string) []Subvolume {
+	var subvolumes []Subvolume
+	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		if strings.TrimSpace(line) == "" {
 			continue
 		}
-		
-		// Output format: ID gen parent top level path
+
+		// Output format: ID <id> gen <gen> top level <id> path <path>
 		if strings.Contains(line, "path ") {
 			// Extract path after "path " keyword
 			pathIndex := strings.Index(line, "path ") + 5
-			path := strings.TrimSpace(line[pathIndex:])
-			
-			// Filter paths by prefix
-			if strings.HasPrefix(path, subvolumePrefix+"/") {
-				subvolumes = append(subvolumes, path)
-			} else if strings.HasPrefix(path, snapshotPrefix+"/") {
-				snapshots = append(snapshots, path)
+			subvolume := Subvolume{Path: strings.TrimSpace(line[pathIndex:])}
+
+			fields := strings.Fields(line[:pathIndex])
+			for i := 0; i+1 < len(fields); i++ {
+				switch fields[i] {
+				case "ID":
+					subvolume.ID, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				case "gen":
+					subvolume.Gen, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				case "level":
+					subvolume.TopLevel, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				}
 			}
+			subvolumes = append(subvolumes, subvolume)
 		}
 	}
 
-	return subvolumes, snapshots, nil
+	return subvolumes
 }
 
-// GetDiskInfo executes 'df' command and returns human-readable disk information
-func GetDiskInfo(path string) (string, error) {
-	cmd := exec.Command("df", "-h", path)
-	output, err := cmd.Output()
+// GetBtrfsSubvolumes executes 'btrfs subvolume list' command and returns filtered results
+func GetBtrfsSubvolumes(path string) (subvolumes []string, snapshots []string, err error) {
+	all, err := ListSubvolumes(path)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
+	subvolumes, snapshots = splitSubvolumes(all)
+	return subvolumes, snapshots, nil
+}
 
-	// Skip header and get only disk information
-	lines := strings.Split(string(output), "\n")
-	if len(lines) < 2 {
-		return "", nil
+// splitSubvolumes separates paths of subvolumes and snapshots by their prefixes
+func splitSubvolumes(all []Subvolume) (subvolumes []string, snapshots []string) {
+	for _, subvolume := range all {
+		// Filter paths by prefix
+		if strings.HasPrefix(subvolume.Path, subvolumePrefix+"/") {
+			subvolumes = append(subvolumes, subvolume.Path)
+		} else if strings.HasPrefix(subvolume.Path, snapshotPrefix+"/") {
+			snapshots = append(snapshots, subvolume.Path)
+		}
 	}
+	return subvolumes, snapshots
+}
 
-	// Split line into fields, removing extra spaces
-	fields := strings.Fields(lines[1])
-	if len(fields) < 6 {
-		return "", nil
+// GetDiskInfo executes 'btrfs filesystem usage' command and returns human-readable disk information
+func GetDiskInfo(path string) (string, error) {
+	usage, err := GetFilesystemUsage(path)
+	if err != nil {
+		return "", err
 	}
-
-	// Format output with labels in compact form
-	return fmt.Sprintf("FS: %s  Size: %s  Used: %s (%s)  Avail: %s",
-		fields[0], fields[1], fields[2], fields[4], fields[3]), nil
+	return strings.Join(usage.Summary(), "\n"), nil
 }
 
-// GetBtrfsSnapshotInfo executes 'btrfs subvolume show' command and returns snapshot information
-func GetBtrfsSnapshotInfo(snapshotPath string) (string, error) {
-	cmd := exec.Command("btrfs", "subvolume", "show", snapshotPath)
-	output, err := cmd.Output()
+// SubvolumeInfo executes 'btrfs subvolume show' command and returns snapshot information
+func (execBackend) SubvolumeInfo(snapshotPath string) (string, error) {
+	output, err := runner.Output("btrfs", "subvolume", "show", snapshotPath)
 	if err != nil {
 		return "", err
 	}
@@ -80,34 +122,176 @@ func GetBtrfsSnapshotInfo(snapshotPath string) (string, error) {
 }
 
 // CreateSnapshot creates a new snapshot for the specified subvolume
-func CreateSnapshot(subvolumePath string, snapshotPath string) error {
-	cmd := exec.Command("btrfs", "subvolume", "snapshot", subvolumePath, snapshotPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create snapshot: %v", err)
+func (execBackend) CreateSnapshot(subvolumePath string, snapshotPath string) error {
+	if output, err := runner.CombinedOutput("btrfs", "subvolume", "snapshot", subvolumePath, snapshotPath); err != nil {
+		return fmt.Errorf("failed to create snapshot: %v: %s", err, strings.TrimSpace(string(output)))
 	}
 	return nil
 }
 
+// deleteArgs returns 'btrfs subvolume delete' arguments for the given paths
+func deleteArgs(paths ...string) []string {
+	args := []string{"subvolume", "delete"}
+	if commitAfterDelete {
+		// Wait for the transaction to commit so freed space is accounted sooner
+		args = append(args, "--commit-after")
+	}
+	return append(args, paths...)
+}
+
 // DeleteSnapshot deletes the specified snapshot
-func DeleteSnapshot(snapshotPath string) error {
-	cmd := exec.Command("btrfs", "subvolume", "delete", snapshotPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to delete snapshot: %v", err)
+func (execBackend) DeleteSnapshot(snapshotPath string) error {
+	if output, err := runner.CombinedOutput("btrfs", deleteArgs(snapshotPath)...); err != nil {
+		return fmt.Errorf("failed to delete snapshot: %v: %s", err, strings.TrimSpace(string(output)))
 	}
 	return nil
 }
 
+// DeleteSnapshots deletes several snapshots with a single 'btrfs subvolume delete' call
+// and returns per-snapshot results
+func (execBackend) DeleteSnapshots(snapshotPaths []string) []DeleteResult {
+	output, cmdErr := runner.CombinedOutput("btrfs", deleteArgs(snapshotPaths...)...)
+
+	// btrfs continues after a failed item, so check which snapshots still exist
+	results := make([]DeleteResult, 0, len(snapshotPaths))
+	for _, path := range snapshotPaths {
+		result := DeleteResult{Path: path}
+		if _, err := os.Lstat(path); err == nil {
+			result.Err = fmt.Errorf("failed to delete snapshot: %s", deleteErrorFor(path, string(output), cmdErr))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// deleteErrorFor extracts the btrfs error message about path from batch delete output
+func deleteErrorFor(path string, output string, cmdErr error) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "ERROR:") && mentionsPath(line, path) {
+			return strings.TrimSpace(strings.TrimPrefix(line, "ERROR:"))
+		}
+	}
+	if cmdErr != nil {
+		return cmdErr.Error()
+	}
+	return "snapshot still exists"
+}
+
+// mentionsPath reports whether a btrfs message names path, either quoted like
+// "cannot delete '/mnt/x'" or as a whole word like "cannot access subvolume /mnt/x: ...".
+// A plain substring match would let "/mnt/x-1" match a message about "/mnt/x-10".
+func mentionsPath(line string, path string) bool {
+	if strings.Contains(line, "'"+path+"'") {
+		return true
+	}
+	for _, field := range strings.Fields(line) {
+		if strings.TrimRight(field, ":,") == path {
+			return true
+		}
+	}
+	return false
+}
+
+// SubvolumeBase returns the base name shared by a subvolume and its snapshots, e.g.
+// "my-data" for both "_active/my-data" and "_snapshots/my-data-20250525-112410-tag".
+// Nested subvolumes like "_active/rootvol/var/lib/machines" share the base of their parent.
+func SubvolumeBase(path string) string {
+	if rest, found := strings.CutPrefix(path, subvolumePrefix+"/"); found {
+		name, _, _ := strings.Cut(rest, "/")
+		return name
+	}
+	rest, found := strings.CutPrefix(path, snapshotPrefix+"/")
+	if !found {
+		return ""
+	}
+	if base, _, ok := splitSnapshotName(rest); ok {
+		return base
+	}
+	return rest
+}
+
+// IsTopSubvolume reports whether path is a subvolume directly below the subvolume prefix,
+// like "_active/rootvol" but not "_active/rootvol/var/lib/machines"
+func IsTopSubvolume(path string) bool {
+	rest, found := strings.CutPrefix(path, subvolumePrefix+"/")
+	return found && rest != "" && !strings.Contains(rest, "/")
+}
+
+// snapshotTimeLayout is the timestamp format appended to snapshot names
+const snapshotTimeLayout = "20060102-150405"
+
+// maxTagLength limits the tag appended to snapshot names
+const maxTagLength = 40
+
+// SnapshotName returns the name of a snapshot of base taken at t, like "rootvol-20250525-112410".
+// A tag is appended after the timestamp in a safe form, e.g. "rootvol-20250525-112410-before-kernel-6.10".
+func SnapshotName(base string, t time.Time, tag string) string {
+	name := fmt.Sprintf("%s-%s", base, t.Format(snapshotTimeLayout))
+	if tag = SanitizeTag(tag); tag != "" {
+		name += "-" + tag
+	}
+	return name
+}
+
+// SanitizeTag reduces text to letters, digits, '.', '_' and '+', replacing other runs of characters with '-'
+func SanitizeTag(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range text {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._+", r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	tag := b.String()
+	if len(tag) > maxTagLength {
+		tag = strings.TrimRight(tag[:maxTagLength], "-")
+	}
+	// Names starting with a dot would be hidden from directory listings
+	return strings.TrimLeft(tag, ".-")
+}
+
+// SnapshotTime parses the creation time encoded in a snapshot name like "rootvol-20250525-112410",
+// optionally followed by a tag
+func SnapshotTime(snapshot string) (time.Time, bool) {
+	_, t, ok := splitSnapshotName(snapshot[strings.LastIndex(snapshot, "/")+1:])
+	return t, ok
+}
+
+// splitSnapshotName splits a snapshot name at its timestamp into the base name and the
+// time. The first timestamp wins, so base names may contain '-' and tags may follow.
+func splitSnapshotName(name string) (string, time.Time, bool) {
+	parts := strings.Split(name, "-")
+	for i := 1; i+1 < len(parts); i++ {
+		t, err := time.ParseInLocation(snapshotTimeLayout, parts[i]+"-"+parts[i+1], time.Local)
+		if err == nil {
+			return strings.Join(parts[:i], "-"), t, true
+		}
+	}
+	return "", time.Time{}, false
+}
+
 // ExecuteCommand runs an arbitrary command with given arguments and returns its output
 func ExecuteCommand(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
-	output, err := cmd.CombinedOutput()
+	output, err := runner.CombinedOutput(name, args...)
+	if err != nil {
+		err = fmt.Errorf("failed to execute command: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	logOperation("run "+strings.Join(append([]string{name}, args...), " "), err)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute command: %v", err)
+		return "", err
 	}
 	return string(output), nil
 }
 
 // ExecuteBtrfsBalance executes btrfs balance command for the specified path
 func ExecuteBtrfsBalance(path string) (string, error) {
-	return ExecuteCommand("btrfs", "balance", "start", "-dusage=15", path)
+	output, err := ExecuteCommand("btrfs", "balance", "start", "-dusage=15", path)
+	audit("balance", path, err)
+	return output, err
 }
@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubvolumeBase(t *testing.T) {
+	for path, want := range map[string]string{
+		"_active/rootvol":                                 "rootvol",
+		"_active/my-data":                                 "my-data",
+		"_active/rootvol/var/lib/machines":                "rootvol",
+		"_snapshots/rootvol-20250525-112410":              "rootvol",
+		"_snapshots/my-data-20250525-112410":              "my-data",
+		"_snapshots/my-data-20250525-112410-before-x-1.0": "my-data",
+		"_snapshots/manual":                               "manual",
+		"elsewhere/rootvol":                               "",
+	} {
+		if got := SubvolumeBase(path); got != want {
+			t.Errorf("SubvolumeBase(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestSnapshotTime(t *testing.T) {
+	want := time.Date(2025, 5, 25, 11, 24, 10, 0, time.Local)
+	for _, snapshot := range []string{
+		"_snapshots/rootvol-20250525-112410",
+		"_snapshots/my-data-20250525-112410-before-upgrade",
+	} {
+		if got, ok := SnapshotTime(snapshot); !ok || !got.Equal(want) {
+			t.Errorf("SnapshotTime(%q) = %v, %v, want %v", snapshot, got, ok, want)
+		}
+	}
+	if _, ok := SnapshotTime("_snapshots/my-data"); ok {
+		t.Errorf("SnapshotTime of a name without timestamp succeeded")
+	}
+}
+
+func TestTopSubvolumes(t *testing.T) {
+	got := TopSubvolumes([]string{"_active/rootvol", "_active/rootvol/var/lib/machines", "_active/my-data"})
+	if len(got) != 2 || got[0] != "_active/rootvol" || got[1] != "_active/my-data" {
+		t.Errorf("TopSubvolumes = %v, want [_active/rootvol _active/my-data]", got)
+	}
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config holds settings read from the configuration file
+type Config struct {
+	// Keys overrides default key bindings, keyed by action name
+	Keys map[string][]string
+	// Theme names a built-in theme, see themes
+	Theme string
+	// Log is the operation log file, "none" disables it
+	Log string
+	// Audit is the audit trail file, "none" disables it
+	Audit string
+	// Syslog also sends audit entries to syslog
+	Syslog bool
+}
+
+// ConfigPath returns the configuration file named by BUTTERFS_CONFIG, or the
+// default under XDG_CONFIG_HOME. The file is required only if named explicitly.
+func ConfigPath() (path string, required bool) {
+	if path := os.Getenv("BUTTERFS_CONFIG"); path != "" {
+		return path, true
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "butterfs", "config"), false
+}
+
+// LoadConfig reads the configuration file at path, a missing optional file gives an empty configuration
+func LoadConfig(path string, required bool) (Config, error) {
+	if path == "" {
+		return Config{}, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %v", err)
+	}
+	config, err := ParseConfig(string(content))
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig parses "name = value" lines, ignoring empty lines and lines starting with #.
+// "key.<action> = <key>, <key>..." binds keys to an action, see the actions table,
+// "theme = <name>" selects a built-in theme, "log = <path>" sets the operation log,
+// "audit = <path>" the audit trail and "syslog = yes" sends audit entries to syslog.
+func ParseConfig(content string) (Config, error) {
+	config := Config{Keys: make(map[string][]string)}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return Config{}, fmt.Errorf("line %d: expected name = value", i+1)
+		}
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case name == "theme":
+			if _, found := themes[strings.ToLower(value)]; !found {
+				return Config{}, fmt.Errorf("line %d: unknown theme %q", i+1, value)
+			}
+			config.Theme = value
+		case name == "log":
+			config.Log = value
+		case name == "audit":
+			config.Audit = value
+		case name == "syslog":
+			switch strings.ToLower(value) {
+			case "yes", "true", "1":
+				config.Syslog = true
+			case "no", "false", "0":
+				config.Syslog = false
+			default:
+				return Config{}, fmt.Errorf("line %d: expected yes or no for syslog", i+1)
+			}
+		case strings.HasPrefix(name, "key."):
+			var keys []string
+			for _, k := range strings.Split(value, ",") {
+				if k = strings.TrimSpace(k); k != "" {
+					keys = append(keys, k)
+				}
+			}
+			config.Keys[strings.TrimPrefix(name, "key.")] = keys
+		default:
+			return Config{}, fmt.Errorf("line %d: unknown setting %q", i+1, name)
+		}
+	}
+	return config, nil
+}
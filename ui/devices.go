@@ -0,0 +1,104 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Device describes a member device of a Btrfs filesystem
+type Device struct {
+	ID   uint64
+	Size uint64
+	Used uint64
+	Path string
+}
+
+// GetDevices executes 'btrfs filesystem show' command and returns member devices
+func GetDevices(path string) ([]Device, error) {
+	output, err := runner.Output("btrfs", "filesystem", "show", "--raw", path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDevices(string(output)), nil
+}
+
+// ParseDevices parses output of 'btrfs filesystem show --raw'
+func ParseDevices(output string) []Device {
+	var devices []Device
+	for _, line := range strings.Split(output, "\n") {
+		// Output format: devid <id> size <bytes> used <bytes> path <device>
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[0] != "devid" {
+			continue
+		}
+		var device Device
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "devid":
+				device.ID, _ = strconv.ParseUint(fields[i+1], 10, 64)
+			case "size":
+				device.Size, _ = strconv.ParseUint(fields[i+1], 10, 64)
+			case "used":
+				device.Used, _ = strconv.ParseUint(fields[i+1], 10, 64)
+			case "path":
+				device.Path = strings.Join(fields[i+1:], " ")
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// AddDevice adds a device to the filesystem mounted at path
+func AddDevice(device string, path string) (err error) {
+	defer func() {
+		logOperation(fmt.Sprintf("add device %s to %s", device, path), err)
+		audit("add-device", device, err)
+	}()
+
+	if output, err := runner.CombinedOutput("btrfs", "device", "add", device, path); err != nil {
+		return fmt.Errorf("failed to add device: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RemoveDevice removes a device from the filesystem, relocating its data to other devices
+func RemoveDevice(device string, path string) (err error) {
+	defer func() {
+		logOperation(fmt.Sprintf("remove device %s from %s", device, path), err)
+		audit("remove-device", device, err)
+	}()
+
+	if output, err := runner.CombinedOutput("btrfs", "device", "remove", device, path); err != nil {
+		return fmt.Errorf("failed to remove device: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// StartReplace starts replacing source device with target device in the background
+func StartReplace(source string, target string, path string) (err error) {
+	defer func() {
+		logOperation(fmt.Sprintf("replace device %s with %s in %s", source, target, path), err)
+		audit("replace-device", source+" with "+target, err)
+	}()
+
+	if output, err := runner.CombinedOutput("btrfs", "replace", "start", source, target, path); err != nil {
+		return fmt.Errorf("failed to start replace: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetReplaceStatus executes 'btrfs replace status' command and returns its one-line status
+func GetReplaceStatus(path string) (string, error) {
+	output, err := runner.Output("btrfs", "replace", "status", "-1", path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ReplaceRunning reports whether a replace status line describes a running replace
+func ReplaceRunning(status string) bool {
+	return strings.Contains(status, "% done")
+}
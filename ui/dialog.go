@@ -0,0 +1,402 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+)
+
+// viewButtons is the button row of the open dialog
+const viewButtons = "dialogButtons"
+
+// Dialogs are at least this wide, wider ones fit their content up to the terminal size
+const (
+	dialogMinWidth      = 30
+	inputDialogMinWidth = 60
+)
+
+// dialogButton is a dialog button, run with Enter while focused, with its key or by clicking it
+type dialogButton struct {
+	label string
+	// key optionally runs the button directly, e.g. 'y'
+	key rune
+	// handler runs after the dialog is closed with the text of the input field, may be nil
+	handler func(value string) error
+}
+
+// dialog is a modal window with a scrollable message, an optional text input and buttons
+type dialog struct {
+	title   string
+	message string
+	// input adds a single line text field, change is called on every edit of it
+	input   bool
+	change  func(value string)
+	buttons []dialogButton
+	// focus is the button run by Enter, moved with Tab
+	focus int
+	// cancel runs when the dialog is closed with Esc, may be nil
+	cancel func() error
+	// rows is the wrapped height of the message, visible how many of them fit
+	rows    int
+	visible int
+}
+
+// showDialog displays a message with an OK button
+func (ui *UI) showDialog(title string, message string) error {
+	return ui.showModal(&dialog{
+		title:   title,
+		message: message,
+		buttons: []dialogButton{{label: "OK"}},
+	})
+}
+
+// showConfirmationDialog displays an action confirmation dialog, running confirmAction on Yes
+func (ui *UI) showConfirmationDialog(message string, confirmAction func(*gocui.Gui, *gocui.View) error) error {
+	return ui.showModal(&dialog{
+		title:   "Action Confirmation",
+		message: message,
+		buttons: []dialogButton{
+			{label: "Yes", key: 'y', handler: func(string) error {
+				return confirmAction(ui.gui, ui.gui.CurrentView())
+			}},
+			{label: "No", key: 'n'},
+		},
+	})
+}
+
+// showInputDialog displays a dialog with a single line text input
+func (ui *UI) showInputDialog(title string, message string, submit func(value string) error) error {
+	return ui.showIncrementalInputDialog(title, message, nil, submit, nil)
+}
+
+// showIncrementalInputDialog is showInputDialog that also reports every edit to change
+// and calls cancel when closed with Esc or Cancel. Both may be nil.
+func (ui *UI) showIncrementalInputDialog(title string, message string, change func(value string),
+	submit func(value string) error, cancel func()) error {
+	cancelHandler := func() error {
+		if cancel != nil {
+			cancel()
+		}
+		return nil
+	}
+	return ui.showModal(&dialog{
+		title:   title,
+		message: message,
+		input:   true,
+		change:  change,
+		buttons: []dialogButton{
+			{label: "Submit", handler: submit},
+			{label: "Cancel", handler: func(string) error { return cancelHandler() }},
+		},
+		cancel: cancelHandler,
+	})
+}
+
+// showModal opens d in place of any open dialog
+func (ui *UI) showModal(d *dialog) error {
+	if err := ui.closeDialog(); err != nil {
+		return err
+	}
+	ui.dialog = d
+	// A sequence started before the dialog must not complete after it closes
+	ui.pendingKeys = nil
+	if err := ui.layoutDialog(); err != nil {
+		return err
+	}
+
+	focused := viewDialog
+	if d.input {
+		focused = viewInput
+		ui.gui.Cursor = true
+	}
+	if _, err := ui.gui.SetCurrentView(focused); err != nil {
+		return err
+	}
+	if err := ui.bindDialog(focused); err != nil {
+		return err
+	}
+	ui.updateHotkeys()
+	return nil
+}
+
+// layoutDialog sizes the open dialog to its content and the terminal, it runs on every layout
+func (ui *UI) layoutDialog() error {
+	d := ui.dialog
+	if d == nil {
+		return nil
+	}
+	maxX, maxY := ui.gui.Size()
+	message := strings.TrimRight(d.message, "\n")
+	lines := strings.Split(message, "\n")
+
+	width := dialogMinWidth
+	if d.input {
+		width = inputDialogMinWidth
+	}
+	for _, line := range append(lines, d.buttonsText(), d.title+"  ") {
+		if w := len([]rune(line)) + 2; w > width {
+			width = w
+		}
+	}
+	if width > maxX-2 {
+		width = maxX - 2
+	}
+	if width < 4 {
+		width = 4
+	}
+
+	// Count rows the way gocui wraps lines at the inner width
+	d.rows = 0
+	for _, line := range lines {
+		d.rows += len([]rune(line))/(width-1) + 1
+	}
+
+	// The button row is preceded by an empty line or the input field
+	reserved := 2
+	if d.input {
+		reserved = 4
+	}
+	height := d.rows + reserved + 1
+	if height > maxY-2 {
+		height = maxY - 2
+	}
+	if height < reserved+2 {
+		height = reserved + 2
+	}
+	d.visible = height - 1 - reserved
+
+	x0, y0 := (maxX-width)/2, (maxY-height)/2
+	x1, y1 := x0+width, y0+height
+	v, err := ui.gui.SetView(viewDialog, x0, y0, x1, y1)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Wrap = true
+		fmt.Fprint(v, message)
+	}
+	v.Title = d.title
+	ui.scrollDialog(0)
+
+	buttonsTop := y1 - 3
+	if d.input {
+		buttonsTop = y1 - 2
+		input, err := ui.gui.SetView(viewInput, x0+1, y1-4, x1-1, y1-2)
+		if err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			input.Editable = true
+			input.Editor = gocui.DefaultEditor
+			if d.change != nil {
+				input.Editor = gocui.EditorFunc(func(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+					gocui.DefaultEditor.Edit(v, key, ch, mod)
+					d.change(strings.TrimSpace(v.Buffer()))
+				})
+			}
+		}
+	}
+
+	buttons, err := ui.gui.SetView(viewButtons, x0, buttonsTop, x1, y1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	buttons.Frame = false
+	buttons.Clear()
+	if !d.input {
+		fmt.Fprintln(buttons)
+	}
+	fmt.Fprint(buttons, d.formatButtons())
+	return nil
+}
+
+// buttonsText is the button row without highlighting
+func (d *dialog) buttonsText() string {
+	labels := make([]string, 0, len(d.buttons))
+	for _, button := range d.buttons {
+		labels = append(labels, "["+button.label+"]")
+	}
+	return strings.Join(labels, "  ")
+}
+
+// formatButtons renders the button row, showing the focused button reversed
+func (d *dialog) formatButtons() string {
+	labels := make([]string, 0, len(d.buttons))
+	for i, button := range d.buttons {
+		label := "[" + button.label + "]"
+		if i == d.focus {
+			label = "\033[7m" + label + colorReset
+		}
+		labels = append(labels, label)
+	}
+	return strings.Join(labels, "  ")
+}
+
+// hotkeys describes the keys of the dialog for the hotkeys bar
+func (d *dialog) hotkeys() string {
+	entries := []string{"Enter: " + d.buttons[d.focus].label}
+	if len(d.buttons) > 1 {
+		entries = append(entries, "Tab: Next button")
+	}
+	for _, button := range d.buttons {
+		if button.key != 0 {
+			entries = append(entries, fmt.Sprintf("%c: %s", button.key, button.label))
+		}
+	}
+	entries = append(entries, "Esc: Close")
+	if d.rows > d.visible {
+		if d.input {
+			entries = append(entries, "PgUp/PgDn: Scroll")
+		} else {
+			entries = append(entries, "↑/↓: Scroll")
+		}
+	}
+	return strings.Join(entries, " | ")
+}
+
+// bindDialog binds the dialog keys in the focused view, the wheel in the message and clicks on buttons
+func (ui *UI) bindDialog(focused string) error {
+	handlers := map[interface{}]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(g *gocui.Gui, v *gocui.View) error { return ui.runButton(ui.dialog.focus) },
+		gocui.KeyTab:   func(g *gocui.Gui, v *gocui.View) error { return ui.focusButton(1) },
+		gocui.KeyEsc:   func(g *gocui.Gui, v *gocui.View) error { return ui.cancelDialog() },
+		gocui.KeyPgup:  func(g *gocui.Gui, v *gocui.View) error { return ui.scrollDialog(-ui.dialog.visible) },
+		gocui.KeyPgdn:  func(g *gocui.Gui, v *gocui.View) error { return ui.scrollDialog(ui.dialog.visible) },
+	}
+	// Letters and arrows edit the text of input dialogs
+	if !ui.dialog.input {
+		for i, button := range ui.dialog.buttons {
+			i := i
+			if button.key != 0 {
+				handlers[button.key] = func(g *gocui.Gui, v *gocui.View) error { return ui.runButton(i) }
+			}
+		}
+		for _, k := range []interface{}{gocui.KeyArrowLeft, 'h'} {
+			handlers[k] = func(g *gocui.Gui, v *gocui.View) error { return ui.focusButton(-1) }
+		}
+		for _, k := range []interface{}{gocui.KeyArrowRight, 'l'} {
+			handlers[k] = func(g *gocui.Gui, v *gocui.View) error { return ui.focusButton(1) }
+		}
+		for _, k := range []interface{}{gocui.KeyArrowUp, 'k'} {
+			handlers[k] = func(g *gocui.Gui, v *gocui.View) error { return ui.scrollDialog(-1) }
+		}
+		for _, k := range []interface{}{gocui.KeyArrowDown, 'j'} {
+			handlers[k] = func(g *gocui.Gui, v *gocui.View) error { return ui.scrollDialog(1) }
+		}
+	}
+	for k, handler := range handlers {
+		if err := ui.gui.SetKeybinding(focused, k, gocui.ModNone, handler); err != nil {
+			return err
+		}
+	}
+
+	if err := ui.gui.SetKeybinding(viewDialog, gocui.MouseWheelUp, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		return ui.scrollDialog(-1)
+	}); err != nil {
+		return err
+	}
+	if err := ui.gui.SetKeybinding(viewDialog, gocui.MouseWheelDown, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		return ui.scrollDialog(1)
+	}); err != nil {
+		return err
+	}
+	return ui.gui.SetKeybinding(viewButtons, gocui.MouseLeft, gocui.ModNone, ui.clickButton)
+}
+
+// focusButton moves the button focus by delta, wrapping around
+func (ui *UI) focusButton(delta int) error {
+	d := ui.dialog
+	if d == nil {
+		return nil
+	}
+	d.focus = (d.focus + delta + len(d.buttons)) % len(d.buttons)
+	ui.updateHotkeys()
+	return ui.layoutDialog()
+}
+
+// clickButton runs the dialog button under the mouse
+func (ui *UI) clickButton(g *gocui.Gui, v *gocui.View) error {
+	word, err := v.Word(v.Cursor())
+	if err != nil || ui.dialog == nil {
+		return nil
+	}
+	for i, button := range ui.dialog.buttons {
+		if strings.Trim(word, "[]") == button.label {
+			return ui.runButton(i)
+		}
+	}
+	return nil
+}
+
+// runButton closes the dialog and runs the handler of button i
+func (ui *UI) runButton(i int) error {
+	d := ui.dialog
+	if d == nil {
+		return nil
+	}
+	value := ""
+	if input, err := ui.gui.View(viewInput); err == nil {
+		value = strings.TrimSpace(input.Buffer())
+	}
+	if err := ui.closeDialog(); err != nil {
+		return err
+	}
+	if handler := d.buttons[i].handler; handler != nil {
+		return handler(value)
+	}
+	return nil
+}
+
+// cancelDialog closes the dialog and runs its cancel handler
+func (ui *UI) cancelDialog() error {
+	d := ui.dialog
+	if d == nil {
+		return nil
+	}
+	if err := ui.closeDialog(); err != nil {
+		return err
+	}
+	if d.cancel != nil {
+		return d.cancel()
+	}
+	return nil
+}
+
+// scrollDialog scrolls the dialog message by delta rows, keeping it within the message
+func (ui *UI) scrollDialog(delta int) error {
+	v, err := ui.gui.View(viewDialog)
+	if err != nil || ui.dialog == nil {
+		return nil
+	}
+	_, oy := v.Origin()
+	oy += delta
+	if limit := ui.dialog.rows - ui.dialog.visible; oy > limit {
+		oy = limit
+	}
+	if oy < 0 {
+		oy = 0
+	}
+	return v.SetOrigin(0, oy)
+}
+
+// closeDialog closes the dialog window
+func (ui *UI) closeDialog() error {
+	for _, name := range []string{viewInput, viewButtons, viewDialog} {
+		if v, _ := ui.gui.View(name); v == nil {
+			continue
+		}
+		ui.gui.DeleteKeybindings(name)
+		if err := ui.gui.DeleteView(name); err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+	}
+	ui.dialog = nil
+	ui.gui.Cursor = false
+
+	if _, err := ui.gui.SetCurrentView(ui.currentView); err != nil {
+		return err
+	}
+	ui.updateHotkeys()
+	return nil
+}
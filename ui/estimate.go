@@ -0,0 +1,238 @@
+package ui
+
+import (
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// maxSampledFiles limits the number of files inspected per exclusive size estimate
+const maxSampledFiles = 2000
+
+// FIEMAP ioctl definitions from linux/fiemap.h
+const (
+	fsIocFiemap        = 0xC020660B
+	fiemapExtentBatch  = 128
+	fiemapExtentLast   = 0x1
+	fiemapExtentShared = 0x2000
+)
+
+type fiemapExtent struct {
+	Logical    uint64
+	Physical   uint64
+	Length     uint64
+	reserved64 [2]uint64
+	Flags      uint32
+	reserved   [3]uint32
+}
+
+type fiemapRequest struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	reserved      uint32
+	Extents       [fiemapExtentBatch]fiemapExtent
+}
+
+// SpaceEstimate is an approximate exclusive size of a subvolume computed without quotas
+type SpaceEstimate struct {
+	Exclusive    uint64
+	Total        uint64
+	SampledFiles int
+	TotalFiles   int
+}
+
+// EstimateExclusive approximates exclusive bytes of a subvolume by sampling file extents.
+// Extents not flagged as shared by FIEMAP are counted as exclusive, and the sampled
+// ratio is extrapolated to the total size of all files.
+func EstimateExclusive(path string, maxSamples int) (SpaceEstimate, error) {
+	var root syscall.Stat_t
+	if err := syscall.Stat(path, &root); err != nil {
+		return SpaceEstimate{}, err
+	}
+
+	var files []string
+	var totalSize uint64
+	err := filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries instead of failing the whole estimate
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		// Do not descend into nested subvolumes, they have their own device number
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Dev != root.Dev {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, name)
+			totalSize += uint64(info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return SpaceEstimate{}, err
+	}
+
+	estimate := SpaceEstimate{Total: totalSize, TotalFiles: len(files)}
+	if len(files) > maxSamples {
+		rand.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+		files = files[:maxSamples]
+	}
+
+	var sampledExclusive, sampledTotal uint64
+	for _, file := range files {
+		exclusive, total, err := fileExclusiveBytes(file)
+		if err != nil {
+			continue
+		}
+		sampledExclusive += exclusive
+		sampledTotal += total
+		estimate.SampledFiles++
+	}
+
+	if sampledTotal > 0 {
+		estimate.Exclusive = uint64(float64(totalSize) * float64(sampledExclusive) / float64(sampledTotal))
+	}
+	return estimate, nil
+}
+
+// fileExclusiveBytes returns bytes of not shared and all extents of a file using FIEMAP
+func fileExclusiveBytes(path string) (exclusive uint64, total uint64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var request fiemapRequest
+	start := uint64(0)
+	for {
+		request = fiemapRequest{Start: start, Length: math.MaxUint64 - start, ExtentCount: fiemapExtentBatch}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&request)))
+		if errno != 0 {
+			return 0, 0, errno
+		}
+		if request.MappedExtents == 0 {
+			return exclusive, total, nil
+		}
+
+		for _, extent := range request.Extents[:request.MappedExtents] {
+			total += extent.Length
+			if extent.Flags&fiemapExtentShared == 0 {
+				exclusive += extent.Length
+			}
+			if extent.Flags&fiemapExtentLast != 0 {
+				return exclusive, total, nil
+			}
+			start = extent.Logical + extent.Length
+		}
+	}
+}
+
+// estimateEntry is a cached exclusive size estimate of one subvolume
+type estimateEntry struct {
+	gen      uint64
+	done     bool
+	estimate SpaceEstimate
+	err      error
+}
+
+// estimateCache runs exclusive size estimates in the background and caches
+// results keyed by subvolume path and generation. A single worker runs one
+// estimate at a time, and only the latest request waits for it, so moving
+// the selection quickly does not pile up estimates of skipped snapshots.
+type estimateCache struct {
+	mu      sync.Mutex
+	entries map[string]estimateEntry
+	// pending is the request to run next, replaced by newer requests
+	pending *estimateRequest
+	running bool
+}
+
+// estimateRequest is an estimate waiting for the worker
+type estimateRequest struct {
+	path   string
+	gen    uint64
+	onDone func()
+}
+
+// newEstimateCache creates an empty estimate cache
+func newEstimateCache() *estimateCache {
+	return &estimateCache{entries: make(map[string]estimateEntry)}
+}
+
+// Get returns the estimate for the subvolume, requesting a background estimate
+// when no entry exists for its current generation. onDone is called from the
+// worker goroutine once a new estimate is stored.
+func (c *estimateCache) Get(path string, gen uint64, onDone func()) estimateEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, found := c.entries[path]; found && entry.gen == gen {
+		return entry
+	}
+
+	// Drop the request not started yet, it is requested again when selected again
+	if c.pending != nil && c.pending.path != path {
+		delete(c.entries, c.pending.path)
+	}
+	entry := estimateEntry{gen: gen}
+	c.entries[path] = entry
+	c.pending = &estimateRequest{path: path, gen: gen, onDone: onDone}
+	if !c.running {
+		c.running = true
+		go c.work()
+	}
+	return entry
+}
+
+// work runs pending estimates until none is left
+func (c *estimateCache) work() {
+	for {
+		c.mu.Lock()
+		request := c.pending
+		c.pending = nil
+		if request == nil {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		estimate, err := EstimateExclusive(request.path, maxSampledFiles)
+
+		c.mu.Lock()
+		// Keep the result only if no newer generation was requested meanwhile
+		if current, found := c.entries[request.path]; found && current.gen == request.gen {
+			c.entries[request.path] = estimateEntry{gen: request.gen, done: true, estimate: estimate, err: err}
+		}
+		c.mu.Unlock()
+
+		request.onDone()
+	}
+}
+
+// Peek returns a finished estimate for the subvolume generation without starting one
+func (c *estimateCache) Peek(path string, gen uint64) (estimateEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[path]
+	if !found || entry.gen != gen || !entry.done || entry.err != nil {
+		return estimateEntry{}, false
+	}
+	return entry, true
+}
@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultExporterListen is the default listen address of the metrics exporter
+const DefaultExporterListen = ":9846"
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	w       io.Writer
+	written map[string]bool
+}
+
+// write writes one sample, preceded by HELP and TYPE lines the first time a metric is seen
+func (m *metricsWriter) write(name string, kind string, help string, labels map[string]string, value float64) {
+	if !m.written[name] {
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		m.written[name] = true
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[key])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, value))
+	}
+
+	if len(pairs) > 0 {
+		fmt.Fprintf(m.w, "%s{%s} %g\n", name, strings.Join(pairs, ","), value)
+	} else {
+		fmt.Fprintf(m.w, "%s %g\n", name, value)
+	}
+}
+
+// WriteMetrics collects filesystem state of path and writes it to w as Prometheus metrics.
+// Collection errors are reported per source with btrfs_collector_success.
+func WriteMetrics(w io.Writer, path string) {
+	m := &metricsWriter{w: w, written: make(map[string]bool)}
+
+	// Samples of one metric must be contiguous, so collector results are written last
+	var sources []string
+	results := make(map[string]error)
+	success := func(source string, err error) {
+		sources = append(sources, source)
+		results[source] = err
+	}
+	defer func() {
+		for _, source := range sources {
+			value := 1.0
+			if results[source] != nil {
+				value = 0
+			}
+			m.write("btrfs_collector_success", "gauge", "Whether collecting a metrics source succeeded.",
+				map[string]string{"source": source}, value)
+		}
+	}()
+
+	subvolumes, snapshots, err := GetBtrfsSubvolumes(path)
+	success("subvolumes", err)
+	if err == nil {
+		writeSnapshotMetrics(m, subvolumes, snapshots)
+	}
+
+	usage, err := GetFilesystemUsage(path)
+	success("usage", err)
+	if err == nil {
+		writeUsageMetrics(m, usage)
+	}
+
+	stats, err := GetDeviceStats(path)
+	success("device_stats", err)
+	for _, s := range stats {
+		counters := map[string]uint64{
+			"write":      s.WriteErrs,
+			"read":       s.ReadErrs,
+			"flush":      s.FlushErrs,
+			"corruption": s.CorruptionErrs,
+			"generation": s.GenerationErrs,
+		}
+		for _, kind := range []string{"write", "read", "flush", "corruption", "generation"} {
+			m.write("btrfs_device_errors_total", "counter", "Device error counters from btrfs device stats.",
+				map[string]string{"device": s.Device, "type": kind}, float64(counters[kind]))
+		}
+	}
+
+	scrub, err := GetScrubStatus(path)
+	success("scrub", err)
+	if err == nil {
+		if scrub.Status != "" {
+			m.write("btrfs_scrub_status", "gauge", "Status of the last scrub.",
+				map[string]string{"status": scrub.Status}, 1)
+		}
+		if !scrub.Started.IsZero() {
+			m.write("btrfs_scrub_last_start_timestamp_seconds", "gauge", "Start time of the last scrub.",
+				nil, float64(scrub.Started.Unix()))
+		}
+		m.write("btrfs_scrub_errors", "gauge", "Errors found by the last scrub.", nil, float64(scrub.Errors))
+		m.write("btrfs_scrub_uncorrectable_errors", "gauge", "Uncorrectable errors found by the last scrub.",
+			nil, float64(scrub.UncorrectableErrors))
+	}
+}
+
+// writeSnapshotMetrics writes snapshot count and newest snapshot age per subvolume.
+// Each metric family is written in one block as the text format requires.
+func writeSnapshotMetrics(m *metricsWriter, subvolumes []string, snapshots []string) {
+	now := time.Now()
+	counts := make([]int, len(subvolumes))
+	newest := make([]time.Time, len(subvolumes))
+	for i, subvolume := range subvolumes {
+		base := SubvolumeBase(subvolume)
+		for _, snapshot := range snapshots {
+			if SubvolumeBase(snapshot) != base {
+				continue
+			}
+			counts[i]++
+			if t, ok := SnapshotTime(snapshot); ok && t.After(newest[i]) {
+				newest[i] = t
+			}
+		}
+	}
+
+	for i, subvolume := range subvolumes {
+		m.write("btrfs_snapshots", "gauge", "Number of snapshots per subvolume.",
+			map[string]string{"subvolume": subvolume}, float64(counts[i]))
+	}
+	for i, subvolume := range subvolumes {
+		if !newest[i].IsZero() {
+			m.write("btrfs_newest_snapshot_age_seconds", "gauge", "Age of the newest snapshot per subvolume.",
+				map[string]string{"subvolume": subvolume}, now.Sub(newest[i]).Seconds())
+		}
+	}
+}
+
+// writeUsageMetrics writes filesystem allocation from btrfs filesystem usage
+func writeUsageMetrics(m *metricsWriter, usage *FilesystemUsage) {
+	m.write("btrfs_device_size_bytes", "gauge", "Total size of all devices.", nil, float64(usage.DeviceSize))
+	m.write("btrfs_device_allocated_bytes", "gauge", "Space allocated to chunks.", nil, float64(usage.DeviceAllocated))
+	m.write("btrfs_device_unallocated_bytes", "gauge", "Space not allocated to chunks.", nil, float64(usage.DeviceUnallocated))
+	m.write("btrfs_used_bytes", "gauge", "Used space.", nil, float64(usage.Used))
+	m.write("btrfs_free_estimated_bytes", "gauge", "Estimated free space.", nil, float64(usage.FreeEstimated))
+	m.write("btrfs_free_min_bytes", "gauge", "Minimum estimated free space.", nil, float64(usage.FreeMin))
+	for _, group := range usage.BlockGroups {
+		m.write("btrfs_block_group_size_bytes", "gauge", "Allocated size per block group type.",
+			blockGroupLabels(group), float64(group.Size))
+	}
+	for _, group := range usage.BlockGroups {
+		m.write("btrfs_block_group_used_bytes", "gauge", "Used size per block group type.",
+			blockGroupLabels(group), float64(group.Used))
+	}
+}
+
+// blockGroupLabels returns the metric labels of a block group
+func blockGroupLabels(group BlockGroupUsage) map[string]string {
+	return map[string]string{"type": strings.ToLower(group.Type), "profile": strings.ToLower(group.Profile)}
+}
+
+// RunExporter serves metrics of the filesystem at path on /metrics until the server fails
+func RunExporter(listen string, path string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// Collect into a buffer so a slow btrfs command does not leave a partial response
+		var buf bytes.Buffer
+		WriteMetrics(&buf, path)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><body><a href="/metrics">Metrics</a></body></html>`)
+	})
+
+	server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := server.ListenAndServe(); err != nil {
+		return fmt.Errorf("exporter failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// FakeRunner returns canned output keyed by the full command line, e.g.
+// "btrfs subvolume list /mnt". Unknown commands fail.
+type FakeRunner map[string]string
+
+func (f FakeRunner) Output(name string, args ...string) ([]byte, error) {
+	commandLine := strings.Join(append([]string{name}, args...), " ")
+	output, found := f[commandLine]
+	if !found {
+		return nil, fmt.Errorf("fake runner: unexpected command %q", commandLine)
+	}
+	return []byte(output), nil
+}
+
+func (f FakeRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	return f.Output(name, args...)
+}
+
+// fakeBtrfs is canned btrfs-progs output of a filesystem mounted at /mnt
+var fakeBtrfs = FakeRunner{
+	"btrfs subvolume list /mnt": `ID 256 gen 120 top level 5 path _active/rootvol
+ID 257 gen 118 top level 5 path _active/homevol
+ID 258 gen 100 top level 5 path _snapshots/rootvol-20250524-101500
+ID 259 gen 110 top level 5 path _snapshots/rootvol-20250525-112410-before-upgrade
+ID 260 gen 111 top level 5 path _snapshots/homevol-20250525-112410-before-upgrade
+`,
+	"btrfs filesystem usage -b /mnt": `Overall:
+    Device size:                 107374182400
+    Device allocated:             32212254720
+    Device unallocated:           75161927680
+    Device missing:                         0
+    Used:                         21474836480
+    Free (estimated):             84825604096	(min: 47244640256)
+    Data ratio:                          1.00
+    Metadata ratio:                      2.00
+    Global reserve:                  53280768	(used: 0)
+
+Data,single: Size:27917287424, Used:19327352832 (69.23%)
+   /dev/sda2	27917287424
+
+Metadata,DUP: Size:2147483648, Used:1073741824 (50.00%)
+   /dev/sda2	4294967296
+
+System,DUP: Size:8388608, Used:16384 (0.20%)
+   /dev/sda2	16777216
+`,
+	"btrfs device stats /mnt": `[/dev/sda2].write_io_errs    0
+[/dev/sda2].read_io_errs     3
+[/dev/sda2].flush_io_errs    0
+[/dev/sda2].corruption_errs  1
+[/dev/sda2].generation_errs  0
+`,
+	"btrfs scrub status -R /mnt": `UUID:             4a2a6f2e-3c1b-4e55-9f55-5d3c0d1f2a11
+Scrub started:    Sun May 25 10:00:00 2025
+Status:           finished
+Duration:         0:05:12
+	data_extents_scrubbed: 120000
+	tree_extents_scrubbed: 9000
+	read_errors: 2
+	csum_errors: 3
+	verify_errors: 0
+	no_csum: 40
+	csum_discards: 0
+	super_errors: 0
+	malloc_errors: 0
+	uncorrectable_errors: 1
+	unverified_errors: 0
+	corrected_errors: 4
+	last_physical: 30000000000
+`,
+}
+
+func TestWriteMetrics(t *testing.T) {
+	SetRunner(fakeBtrfs)
+	defer SetRunner(execRunner{})
+
+	var buf bytes.Buffer
+	WriteMetrics(&buf, "/mnt")
+	output := buf.String()
+
+	for _, sample := range []string{
+		`btrfs_snapshots{subvolume="_active/rootvol"} 2`,
+		`btrfs_snapshots{subvolume="_active/homevol"} 1`,
+		`btrfs_device_size_bytes 1.073741824e+11`,
+		`btrfs_free_min_bytes 4.7244640256e+10`,
+		`btrfs_block_group_size_bytes{profile="dup",type="metadata"} 2.147483648e+09`,
+		`btrfs_block_group_used_bytes{profile="single",type="data"} 1.9327352832e+10`,
+		`btrfs_device_errors_total{device="/dev/sda2",type="read"} 3`,
+		`btrfs_device_errors_total{device="/dev/sda2",type="corruption"} 1`,
+		`btrfs_scrub_status{status="finished"} 1`,
+		`btrfs_scrub_errors 5`,
+		`btrfs_scrub_uncorrectable_errors 1`,
+		`btrfs_collector_success{source="subvolumes"} 1`,
+		`btrfs_collector_success{source="scrub"} 1`,
+	} {
+		if !strings.Contains(output, sample+"\n") {
+			t.Errorf("missing sample %q in output:\n%s", sample, output)
+		}
+	}
+	if !strings.Contains(output, `btrfs_newest_snapshot_age_seconds{subvolume="_active/rootvol"} `) {
+		t.Errorf("missing newest snapshot age of _active/rootvol in output:\n%s", output)
+	}
+
+	// All samples of a metric family must follow each other
+	finished := make(map[string]bool)
+	current := ""
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var name string
+		if strings.HasPrefix(line, "# ") {
+			name = strings.Fields(line)[2]
+		} else {
+			name = strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]
+		}
+		if name == current {
+			continue
+		}
+		if finished[name] {
+			t.Errorf("samples of %s are not contiguous:\n%s", name, output)
+		}
+		finished[current] = true
+		current = name
+	}
+}
+
+func TestWriteMetricsFailedSource(t *testing.T) {
+	runner := FakeRunner{}
+	for command, output := range fakeBtrfs {
+		if command != "btrfs scrub status -R /mnt" {
+			runner[command] = output
+		}
+	}
+	SetRunner(runner)
+	defer SetRunner(execRunner{})
+
+	var buf bytes.Buffer
+	WriteMetrics(&buf, "/mnt")
+	output := buf.String()
+
+	if !strings.Contains(output, `btrfs_collector_success{source="scrub"} 0`+"\n") {
+		t.Errorf("scrub failure not reported in output:\n%s", output)
+	}
+	if strings.Contains(output, "btrfs_scrub_errors") {
+		t.Errorf("scrub metrics written despite failure:\n%s", output)
+	}
+}
@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// filterDateLayout is the date format of from: and to: filter terms
+const filterDateLayout = "2006-01-02"
+
+// Filter selects list items by name substrings and the creation date encoded in snapshot names
+type Filter struct {
+	// Text is the filter as entered, empty when nothing is filtered
+	Text  string
+	Terms []string
+	// From and To bound the snapshot date, zero values leave the range open
+	From time.Time
+	To   time.Time
+}
+
+// ParseFilter parses space-separated terms. "from:YYYY-MM-DD" and "to:YYYY-MM-DD"
+// bound the date inclusively, every other term must occur in the name (case-insensitive).
+func ParseFilter(text string) (Filter, error) {
+	filter := Filter{Text: strings.TrimSpace(text)}
+	for _, term := range strings.Fields(text) {
+		switch {
+		case strings.HasPrefix(term, "from:"):
+			date, err := time.ParseInLocation(filterDateLayout, strings.TrimPrefix(term, "from:"), time.Local)
+			if err != nil {
+				return Filter{}, fmt.Errorf("invalid date in %q, expected from:YYYY-MM-DD", term)
+			}
+			filter.From = date
+		case strings.HasPrefix(term, "to:"):
+			date, err := time.ParseInLocation(filterDateLayout, strings.TrimPrefix(term, "to:"), time.Local)
+			if err != nil {
+				return Filter{}, fmt.Errorf("invalid date in %q, expected to:YYYY-MM-DD", term)
+			}
+			// Include the whole last day
+			filter.To = date.AddDate(0, 0, 1)
+		default:
+			filter.Terms = append(filter.Terms, strings.ToLower(term))
+		}
+	}
+	return filter, nil
+}
+
+// Active reports whether the filter hides any items
+func (f Filter) Active() bool {
+	return f.Text != ""
+}
+
+// Match reports whether item passes the filter. Items without a date in
+// their name never pass a date range.
+func (f Filter) Match(item string) bool {
+	name := strings.ToLower(item)
+	for _, term := range f.Terms {
+		if !strings.Contains(name, term) {
+			return false
+		}
+	}
+	if f.From.IsZero() && f.To.IsZero() {
+		return true
+	}
+	created, ok := SnapshotTime(item)
+	if !ok {
+		return false
+	}
+	if !f.From.IsZero() && created.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !created.Before(f.To) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package ui
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rollbackTag tags the snapshots holding subvolumes replaced by a rollback
+const rollbackTag = "before-rollback"
+
+// newGroupID returns an ID for snapshots taken together, unique even for groups
+// taken in the same second
+func newGroupID(t time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return t.Format(snapshotTimeLayout) + "-" + hex.EncodeToString(suffix)
+}
+
+// GroupMembers returns the snapshots belonging to group, sorted by name. groupOf
+// returns the group ID stored on a snapshot.
+func GroupMembers(snapshots []string, group string, groupOf func(snapshot string) string) []string {
+	var members []string
+	if group == "" {
+		return members
+	}
+	for _, snapshot := range snapshots {
+		if groupOf(snapshot) == group {
+			members = append(members, snapshot)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// TopSubvolumes returns the subvolumes directly below the subvolume prefix. Nested
+// subvolumes, e.g. of systemd-machined or Docker, are left out: snapshots of their
+// parent do not include them and they share its base name.
+func TopSubvolumes(subvolumes []string) []string {
+	var top []string
+	for _, subvolume := range subvolumes {
+		if IsTopSubvolume(subvolume) {
+			top = append(top, subvolume)
+		}
+	}
+	return top
+}
+
+// SnapshotAll snapshots subvolumes of the filesystem at path with one timestamp and tag,
+// returning the snapshot names. Each snapshot records its source subvolume and a group
+// ID shared by the group. If a snapshot fails, the ones already taken are deleted
+// so no partial group is left behind, those that could not be deleted are returned.
+// Descriptions that cannot be set do not stop the group, all snapshots are returned
+// together with an error naming them.
+func SnapshotAll(path string, subvolumes []string, t time.Time, tag string) ([]string, error) {
+	// Refuse subvolumes whose snapshots would collide before creating anything
+	bases := make(map[string]string, len(subvolumes))
+	for _, subvolume := range subvolumes {
+		if !IsTopSubvolume(subvolume) {
+			return nil, fmt.Errorf("%s is not directly below %s", subvolume, subvolumePrefix)
+		}
+		base := SubvolumeBase(subvolume)
+		if other, found := bases[base]; found {
+			return nil, fmt.Errorf("%s and %s would both be snapshotted as %s", other, subvolume, base)
+		}
+		bases[base] = subvolume
+	}
+
+	group := newGroupID(t)
+	var created, undescribed []string
+	for _, subvolume := range subvolumes {
+		name := fmt.Sprintf("%s/%s", snapshotPrefix, SnapshotName(SubvolumeBase(subvolume), t, tag))
+		destPath := fmt.Sprintf("%s/%s", path, name)
+		err := CreateSnapshot(fmt.Sprintf("%s/%s", path, subvolume), destPath)
+		if err == nil {
+			created = append(created, name)
+			// Without its origin the snapshot would not be part of the group
+			err = SetSnapshotOrigin(destPath, subvolume, group)
+		}
+		if err != nil {
+			var left []string
+			for _, snapshot := range created {
+				if DeleteSnapshot(fmt.Sprintf("%s/%s", path, snapshot)) != nil {
+					left = append(left, snapshot)
+				}
+			}
+			if len(left) > 0 {
+				return left, fmt.Errorf("%s: %v\nfailed to remove partial group: %s", subvolume, err, strings.Join(left, ", "))
+			}
+			return nil, fmt.Errorf("%s: %v", subvolume, err)
+		}
+		if tag != "" {
+			if err := SetDescription(destPath, tag); err != nil {
+				undescribed = append(undescribed, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	if len(undescribed) > 0 {
+		return created, fmt.Errorf("failed to set description:\n%s", strings.Join(undescribed, "\n"))
+	}
+	return created, nil
+}
+
+// RollbackGroup makes each snapshot of a group the active subvolume it was taken of again,
+// as recorded by SnapshotAll. The replaced subvolumes are kept as snapshots tagged
+// before-rollback. Mounted subvolumes keep running from the replaced copy until they are
+// mounted again, e.g. after a reboot. If a member fails, the members already rolled back
+// are restored so the group stays consistent, the error lists any that could not be restored.
+func RollbackGroup(path string, members []string, t time.Time) error {
+	// Resolve all targets first, so a member without origin does not stop a rollback midway
+	sources := make(map[string]string, len(members))
+	for _, snapshot := range members {
+		source, _, err := GetSnapshotOrigin(fmt.Sprintf("%s/%s", path, snapshot))
+		if err != nil {
+			return fmt.Errorf("%s: %v", snapshot, err)
+		}
+		if !IsTopSubvolume(source) {
+			return fmt.Errorf("%s: no subvolume below %s recorded as its source", snapshot, subvolumePrefix)
+		}
+		sources[snapshot] = source
+	}
+
+	var done []string
+	kept := make(map[string]string)
+	for _, snapshot := range members {
+		activePath := fmt.Sprintf("%s/%s", path, sources[snapshot])
+		keptPath, err := rollbackSubvolume(path, snapshot, sources[snapshot], t)
+		audit("rollback", fmt.Sprintf("%s to %s/%s", activePath, path, snapshot), err)
+		if err != nil {
+			var restored, left []string
+			for i := len(done) - 1; i >= 0; i-- {
+				donePath := fmt.Sprintf("%s/%s", path, sources[done[i]])
+				undoErr := undoRollback(donePath, kept[done[i]])
+				audit("undo rollback", donePath, undoErr)
+				if undoErr != nil {
+					left = append(left, fmt.Sprintf("%s: %v", donePath, undoErr))
+				} else {
+					restored = append(restored, donePath)
+				}
+			}
+			message := fmt.Sprintf("%v", err)
+			if len(restored) > 0 {
+				message += fmt.Sprintf("\nrestored: %s", strings.Join(restored, ", "))
+			}
+			if len(left) > 0 {
+				message += fmt.Sprintf("\nstill rolled back:\n%s", strings.Join(left, "\n"))
+			}
+			return fmt.Errorf("%s", message)
+		}
+		done = append(done, snapshot)
+		kept[snapshot] = keptPath
+	}
+	return nil
+}
+
+// rollbackSubvolume replaces the active subvolume source with a writable snapshot of
+// snapshot, returning where the replaced subvolume was moved, empty if there was none
+func rollbackSubvolume(path string, snapshot string, source string, t time.Time) (string, error) {
+	activePath := fmt.Sprintf("%s/%s", path, source)
+	keptPath := ""
+	if _, err := os.Stat(activePath); err == nil {
+		keptPath = fmt.Sprintf("%s/%s/%s", path, snapshotPrefix, SnapshotName(SubvolumeBase(source), t, rollbackTag))
+		err := os.Rename(activePath, keptPath)
+		logOperation(fmt.Sprintf("move %s to %s", activePath, keptPath), err)
+		if err != nil {
+			return "", fmt.Errorf("failed to move %s aside: %v", activePath, err)
+		}
+		// The kept copy can be rolled back to like any snapshot of source
+		SetSnapshotOrigin(keptPath, source, "")
+	}
+	if err := CreateSnapshot(fmt.Sprintf("%s/%s", path, snapshot), activePath); err != nil {
+		// Put the replaced subvolume back so the base is not left without one
+		if keptPath != "" {
+			logOperation(fmt.Sprintf("move %s back to %s", keptPath, activePath), os.Rename(keptPath, activePath))
+		}
+		return "", fmt.Errorf("failed to restore %s: %v", snapshot, err)
+	}
+	// Otherwise snapshots of the restored subvolume would join the old group
+	clearSnapshotAttributes(activePath)
+	return keptPath, nil
+}
+
+// undoRollback deletes the restored subvolume at activePath and moves the replaced one
+// back from keptPath
+func undoRollback(activePath string, keptPath string) error {
+	if err := DeleteSnapshot(activePath); err != nil {
+		return err
+	}
+	if keptPath == "" {
+		return nil
+	}
+	err := os.Rename(keptPath, activePath)
+	logOperation(fmt.Sprintf("move %s back to %s", keptPath, activePath), err)
+	if err != nil {
+		return fmt.Errorf("failed to move %s back: %v", keptPath, err)
+	}
+	// The active subvolume is no snapshot of itself
+	clearSnapshotAttributes(activePath)
+	return nil
+}
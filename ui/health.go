@@ -0,0 +1,160 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeviceStats holds error counters of one device from 'btrfs device stats'
+type DeviceStats struct {
+	Device         string
+	WriteErrs      uint64
+	ReadErrs       uint64
+	FlushErrs      uint64
+	CorruptionErrs uint64
+	GenerationErrs uint64
+}
+
+// Total returns the sum of all error counters
+func (s DeviceStats) Total() uint64 {
+	return s.WriteErrs + s.ReadErrs + s.FlushErrs + s.CorruptionErrs + s.GenerationErrs
+}
+
+// GetDeviceStats executes 'btrfs device stats' command and returns error counters per device
+func GetDeviceStats(path string) ([]DeviceStats, error) {
+	output, err := runner.Output("btrfs", "device", "stats", path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeviceStats(string(output)), nil
+}
+
+// ParseDeviceStats parses output of 'btrfs device stats'
+func ParseDeviceStats(output string) []DeviceStats {
+	var stats []DeviceStats
+	index := make(map[string]int)
+	for _, line := range strings.Split(output, "\n") {
+		// Output format: [<device>].<counter> <value>
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "[") {
+			continue
+		}
+		closing := strings.LastIndex(fields[0], "].")
+		if closing < 0 {
+			continue
+		}
+		device, counter := fields[0][1:closing], fields[0][closing+2:]
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		i, found := index[device]
+		if !found {
+			i = len(stats)
+			index[device] = i
+			stats = append(stats, DeviceStats{Device: device})
+		}
+		switch counter {
+		case "write_io_errs":
+			stats[i].WriteErrs = value
+		case "read_io_errs":
+			stats[i].ReadErrs = value
+		case "flush_io_errs":
+			stats[i].FlushErrs = value
+		case "corruption_errs":
+			stats[i].CorruptionErrs = value
+		case "generation_errs":
+			stats[i].GenerationErrs = value
+		}
+	}
+	return stats
+}
+
+// ResetDeviceStats resets error counters of all devices of the filesystem
+func ResetDeviceStats(path string) (err error) {
+	defer func() {
+		logOperation("reset device stats of "+path, err)
+		audit("reset-stats", path, err)
+	}()
+
+	if output, err := runner.CombinedOutput("btrfs", "device", "stats", "-z", path); err != nil {
+		return fmt.Errorf("failed to reset device stats: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CheckHealth writes error counters of all devices to w and reports whether all of them are zero
+func CheckHealth(w io.Writer, path string) (bool, error) {
+	stats, err := GetDeviceStats(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to get device stats: %v", err)
+	}
+
+	healthy := true
+	fmt.Fprintf(w, "%-20s %8s %8s %8s %8s %8s\n", "DEVICE", "WRITE", "READ", "FLUSH", "CORRUPT", "GEN")
+	for _, s := range stats {
+		if s.Total() > 0 {
+			healthy = false
+		}
+		fmt.Fprintf(w, "%-20s %8d %8d %8d %8d %8d\n",
+			s.Device, s.WriteErrs, s.ReadErrs, s.FlushErrs, s.CorruptionErrs, s.GenerationErrs)
+	}
+	return healthy, nil
+}
+
+// ScrubStatus holds the result of the last scrub from 'btrfs scrub status -R'
+type ScrubStatus struct {
+	Status              string
+	Started             time.Time
+	Errors              uint64
+	UncorrectableErrors uint64
+}
+
+// scrubStartedLayout is the time format of the "Scrub started" line
+const scrubStartedLayout = "Mon Jan _2 15:04:05 2006"
+
+// scrubErrorClasses are the keys of 'btrfs scrub status -R' counting errors found. The
+// corrected and uncorrectable counts split the same errors again and are not added.
+var scrubErrorClasses = map[string]bool{
+	"read_errors":   true,
+	"csum_errors":   true,
+	"verify_errors": true,
+	"super_errors":  true,
+}
+
+// GetScrubStatus executes 'btrfs scrub status -R' command and returns the last scrub result
+func GetScrubStatus(path string) (*ScrubStatus, error) {
+	output, err := runner.Output("btrfs", "scrub", "status", "-R", path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScrubStatus(string(output)), nil
+}
+
+// ParseScrubStatus parses output of 'btrfs scrub status -R'
+func ParseScrubStatus(output string) *ScrubStatus {
+	status := &ScrubStatus{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "Status":
+			status.Status = value
+		case key == "Scrub started":
+			status.Started, _ = time.ParseInLocation(scrubStartedLayout, value, time.Local)
+		case scrubErrorClasses[key]:
+			count, _ := strconv.ParseUint(value, 10, 64)
+			status.Errors += count
+		case key == "uncorrectable_errors":
+			status.UncorrectableErrors, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return status
+}
@@ -0,0 +1,402 @@
+package ui
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioctlBackend implements Backend with native Btrfs ioctls instead of btrfs-progs
+type ioctlBackend struct{}
+
+// Btrfs ioctl definitions from linux/btrfs.h and linux/btrfs_tree.h
+const (
+	btrfsIoctlMagic = 0x94
+
+	iocWrite = 1
+	iocRead  = 2
+
+	rootTreeObjectID  = 1
+	rootItemKey       = 132
+	rootBackrefKey    = 144
+	lastFreeObjectID  = math.MaxUint64 - 255
+	subvolReadOnly    = 1 << 1
+	volNameMax        = 4039
+	rootItemGenOffset = 160
+)
+
+// ioc encodes an ioctl request number as the _IOC macro does
+func ioc(dir uintptr, nr uintptr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | btrfsIoctlMagic<<8 | nr
+}
+
+var (
+	iocSync           = ioc(0, 8, 0)
+	iocSnapDestroy    = ioc(iocWrite, 15, unsafe.Sizeof(volArgs{}))
+	iocTreeSearch     = ioc(iocWrite|iocRead, 17, unsafe.Sizeof(searchArgs{}))
+	iocInoLookup      = ioc(iocWrite|iocRead, 18, unsafe.Sizeof(inoLookupArgs{}))
+	iocSnapCreateV2   = ioc(iocWrite, 23, unsafe.Sizeof(volArgsV2{}))
+	iocSubvolGetflags = ioc(iocRead, 25, unsafe.Sizeof(uint64(0)))
+	iocGetSubvolInfo  = ioc(iocRead, 60, unsafe.Sizeof(getSubvolInfoArgs{}))
+	iocSnapDestroyV2  = ioc(iocWrite, 63, unsafe.Sizeof(volArgsV2{}))
+)
+
+type volArgs struct {
+	Fd   int64
+	Name [4088]byte
+}
+
+type volArgsV2 struct {
+	Fd      int64
+	Transid uint64
+	Flags   uint64
+	Unused  [4]uint64
+	Name    [volNameMax + 1]byte
+}
+
+type searchKey struct {
+	TreeID      uint64
+	MinObjectID uint64
+	MaxObjectID uint64
+	MinOffset   uint64
+	MaxOffset   uint64
+	MinTransid  uint64
+	MaxTransid  uint64
+	MinType     uint32
+	MaxType     uint32
+	NrItems     uint32
+	unused      uint32
+	unused1     [4]uint64
+}
+
+type searchArgs struct {
+	Key searchKey
+	Buf [4096 - unsafe.Sizeof(searchKey{})]byte
+}
+
+type searchHeader struct {
+	Transid  uint64
+	ObjectID uint64
+	Offset   uint64
+	Type     uint32
+	Len      uint32
+}
+
+type inoLookupArgs struct {
+	TreeID   uint64
+	ObjectID uint64
+	Name     [4080]byte
+}
+
+type ioctlTimespec struct {
+	Sec  uint64
+	Nsec uint32
+	_    uint32
+}
+
+type getSubvolInfoArgs struct {
+	TreeID       uint64
+	Name         [256]byte
+	ParentID     uint64
+	DirID        uint64
+	Generation   uint64
+	Flags        uint64
+	UUID         [16]byte
+	ParentUUID   [16]byte
+	ReceivedUUID [16]byte
+	Ctransid     uint64
+	Otransid     uint64
+	Stransid     uint64
+	Rtransid     uint64
+	Ctime        ioctlTimespec
+	Otime        ioctlTimespec
+	Stime        ioctlTimespec
+	Rtime        ioctlTimespec
+	Reserved     [8]uint64
+}
+
+// ioctl issues an ioctl request on fd
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openDir opens a directory for issuing ioctls
+func openDir(path string) (int, error) {
+	return unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+}
+
+// cString converts a NUL-terminated byte array to a string
+func cString(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+// subvolumeRef is the location of a subvolume inside its parent
+type subvolumeRef struct {
+	gen      uint64
+	parent   uint64
+	dirID    uint64
+	name     string
+	hasRef   bool
+	resolved string
+}
+
+// ListSubvolumes searches the root tree for subvolume items and back references
+func (ioctlBackend) ListSubvolumes(path string) ([]Subvolume, error) {
+	fd, err := openDir(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	refs := make(map[uint64]*subvolumeRef)
+	args := searchArgs{Key: searchKey{
+		TreeID:      rootTreeObjectID,
+		MinObjectID: firstFreeObjectID,
+		MaxObjectID: lastFreeObjectID,
+		MinType:     rootItemKey,
+		MaxType:     rootBackrefKey,
+		MaxOffset:   math.MaxUint64,
+		MaxTransid:  math.MaxUint64,
+	}}
+	for {
+		args.Key.NrItems = 4096
+		if err := ioctl(fd, iocTreeSearch, unsafe.Pointer(&args)); err != nil {
+			return nil, fmt.Errorf("tree search failed: %v", err)
+		}
+		if args.Key.NrItems == 0 {
+			break
+		}
+
+		var last searchHeader
+		offset := uintptr(0)
+		for i := uint32(0); i < args.Key.NrItems; i++ {
+			header := *(*searchHeader)(unsafe.Pointer(&args.Buf[offset]))
+			data := args.Buf[offset+unsafe.Sizeof(header) : offset+unsafe.Sizeof(header)+uintptr(header.Len)]
+			offset += unsafe.Sizeof(header) + uintptr(header.Len)
+			last = header
+
+			ref := refs[header.ObjectID]
+			if ref == nil {
+				ref = &subvolumeRef{}
+				refs[header.ObjectID] = ref
+			}
+			switch header.Type {
+			case rootItemKey:
+				if len(data) >= rootItemGenOffset+8 {
+					ref.gen = binary.LittleEndian.Uint64(data[rootItemGenOffset:])
+				}
+			case rootBackrefKey:
+				// struct btrfs_root_ref: dirid, sequence, name_len, then the name
+				if len(data) >= 18 {
+					nameLen := int(binary.LittleEndian.Uint16(data[16:]))
+					if len(data) >= 18+nameLen {
+						ref.parent = header.Offset
+						ref.dirID = binary.LittleEndian.Uint64(data[0:])
+						ref.name = string(data[18 : 18+nameLen])
+						ref.hasRef = true
+					}
+				}
+			}
+		}
+
+		// Continue after the last returned key
+		args.Key.MinObjectID = last.ObjectID
+		args.Key.MinType = last.Type
+		args.Key.MinOffset = last.Offset + 1
+		if last.Offset == math.MaxUint64 {
+			args.Key.MinOffset = 0
+			args.Key.MinType++
+			if last.Type == rootBackrefKey {
+				args.Key.MinType = rootItemKey
+				args.Key.MinObjectID++
+			}
+		}
+		if args.Key.MinObjectID > lastFreeObjectID || args.Key.MinObjectID < last.ObjectID {
+			break
+		}
+	}
+
+	var subvolumes []Subvolume
+	for id, ref := range refs {
+		// Deleted subvolumes have no back reference
+		if !ref.hasRef {
+			continue
+		}
+		fullPath, err := resolveSubvolumePath(fd, refs, id)
+		if err != nil {
+			return nil, err
+		}
+		subvolumes = append(subvolumes, Subvolume{ID: id, Gen: ref.gen, TopLevel: ref.parent, Path: fullPath})
+	}
+	sort.Slice(subvolumes, func(i, j int) bool { return subvolumes[i].ID < subvolumes[j].ID })
+	return subvolumes, nil
+}
+
+// resolveSubvolumePath returns the path of a subvolume relative to the top-level subvolume
+func resolveSubvolumePath(fd int, refs map[uint64]*subvolumeRef, id uint64) (string, error) {
+	ref := refs[id]
+	if ref.resolved != "" {
+		return ref.resolved, nil
+	}
+
+	prefix := ""
+	if parent, found := refs[ref.parent]; found && parent.hasRef {
+		parentPath, err := resolveSubvolumePath(fd, refs, ref.parent)
+		if err != nil {
+			return "", err
+		}
+		prefix = parentPath + "/"
+	}
+
+	// Directory of the subvolume inside its parent, returned with a trailing slash
+	args := inoLookupArgs{TreeID: ref.parent, ObjectID: ref.dirID}
+	if err := ioctl(fd, iocInoLookup, unsafe.Pointer(&args)); err != nil {
+		return "", fmt.Errorf("inode lookup failed: %v", err)
+	}
+
+	ref.resolved = prefix + cString(args.Name[:]) + ref.name
+	return ref.resolved, nil
+}
+
+// SubvolumeInfo returns information about a subvolume in the format of 'btrfs subvolume show'
+func (ioctlBackend) SubvolumeInfo(path string) (string, error) {
+	fd, err := openDir(path)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+
+	var info getSubvolInfoArgs
+	if err := ioctl(fd, iocGetSubvolInfo, unsafe.Pointer(&info)); err != nil {
+		return "", fmt.Errorf("failed to get subvolume info: %v", err)
+	}
+
+	flags := "-"
+	if info.Flags&subvolReadOnly != 0 {
+		flags = "readonly"
+	}
+	created := time.Unix(int64(info.Otime.Sec), int64(info.Otime.Nsec))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", path)
+	fmt.Fprintf(&b, "\tName: \t\t\t%s\n", cString(info.Name[:]))
+	fmt.Fprintf(&b, "\tUUID: \t\t\t%s\n", formatUUID(info.UUID))
+	fmt.Fprintf(&b, "\tParent UUID: \t\t%s\n", formatUUID(info.ParentUUID))
+	fmt.Fprintf(&b, "\tReceived UUID: \t\t%s\n", formatUUID(info.ReceivedUUID))
+	fmt.Fprintf(&b, "\tCreation time: \t\t%s\n", created.Format("2006-01-02 15:04:05 -0700"))
+	fmt.Fprintf(&b, "\tSubvolume ID: \t\t%d\n", info.TreeID)
+	fmt.Fprintf(&b, "\tGeneration: \t\t%d\n", info.Generation)
+	fmt.Fprintf(&b, "\tGen at creation: \t%d\n", info.Otransid)
+	fmt.Fprintf(&b, "\tParent ID: \t\t%d\n", info.ParentID)
+	fmt.Fprintf(&b, "\tTop level ID: \t\t%d\n", info.ParentID)
+	fmt.Fprintf(&b, "\tFlags: \t\t\t%s\n", flags)
+	return b.String(), nil
+}
+
+// IsReadOnly reports whether the subvolume at path is read-only, using
+// BTRFS_IOC_SUBVOL_GETFLAGS with either backend since it needs no process
+func IsReadOnly(path string) (bool, error) {
+	fd, err := openDir(path)
+	if err != nil {
+		return false, err
+	}
+	defer unix.Close(fd)
+
+	var flags uint64
+	if err := ioctl(fd, iocSubvolGetflags, unsafe.Pointer(&flags)); err != nil {
+		return false, fmt.Errorf("failed to get subvolume flags: %v", err)
+	}
+	return flags&subvolReadOnly != 0, nil
+}
+
+// formatUUID formats a UUID, or "-" if it is unset
+func formatUUID(uuid [16]byte) string {
+	if uuid == [16]byte{} {
+		return "-"
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// CreateSnapshot creates a snapshot with BTRFS_IOC_SNAP_CREATE_V2
+func (ioctlBackend) CreateSnapshot(subvolumePath string, snapshotPath string) error {
+	name := filepath.Base(snapshotPath)
+	if len(name) > volNameMax {
+		return fmt.Errorf("failed to create snapshot: name too long")
+	}
+
+	source, err := openDir(subvolumePath)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	defer unix.Close(source)
+
+	parent, err := openDir(filepath.Dir(snapshotPath))
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	defer unix.Close(parent)
+
+	args := volArgsV2{Fd: int64(source)}
+	copy(args.Name[:], name)
+	if err := ioctl(parent, iocSnapCreateV2, unsafe.Pointer(&args)); err != nil {
+		return fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	return nil
+}
+
+// DeleteSnapshot deletes a snapshot with BTRFS_IOC_SNAP_DESTROY_V2, falling back
+// to BTRFS_IOC_SNAP_DESTROY on kernels older than 5.7
+func (ioctlBackend) DeleteSnapshot(snapshotPath string) error {
+	name := filepath.Base(snapshotPath)
+	if len(name) > volNameMax {
+		return fmt.Errorf("failed to delete snapshot: name too long")
+	}
+
+	parent, err := openDir(filepath.Dir(snapshotPath))
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %v", err)
+	}
+	defer unix.Close(parent)
+
+	args := volArgsV2{}
+	copy(args.Name[:], name)
+	err = ioctl(parent, iocSnapDestroyV2, unsafe.Pointer(&args))
+	if err == unix.ENOTTY || err == unix.EOPNOTSUPP {
+		legacy := volArgs{}
+		copy(legacy.Name[:], name)
+		err = ioctl(parent, iocSnapDestroy, unsafe.Pointer(&legacy))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %v", err)
+	}
+
+	if commitAfterDelete {
+		// Commit the transaction so freed space is accounted sooner
+		if err := ioctl(parent, iocSync, nil); err != nil {
+			return fmt.Errorf("failed to commit deletion: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteSnapshots deletes snapshots one by one and returns per-snapshot results
+func (b ioctlBackend) DeleteSnapshots(snapshotPaths []string) []DeleteResult {
+	results := make([]DeleteResult, 0, len(snapshotPaths))
+	for _, path := range snapshotPaths {
+		results = append(results, DeleteResult{Path: path, Err: b.DeleteSnapshot(path)})
+	}
+	return results
+}
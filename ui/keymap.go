@@ -0,0 +1,356 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jroimartin/gocui"
+)
+
+// action is a command that can be bound to keys in the views it applies to
+type action struct {
+	name        string
+	description string
+	views       []string
+	// keys are the default bindings, overridden by "key.<name>" in the configuration file
+	keys []string
+	// bar shows the action in the hotkeys bar, all actions are listed in the help overlay
+	bar     bool
+	handler func(ui *UI, g *gocui.Gui, v *gocui.View) error
+}
+
+// listViews are views with searchable and filterable lists
+var listViews = []string{viewSubvolumes, viewSnapshots}
+
+// actions lists all bindable commands in the order they are shown
+var actions = []action{
+	{"quit", "Quit", navigableViews, []string{"q"}, true, func(ui *UI, g *gocui.Gui, v *gocui.View) error { return quit(g, v) }},
+	{"prev-view", "Previous view", navigableViews, []string{"Left", "h"}, true, (*UI).prevView},
+	{"next-view", "Next view", navigableViews, []string{"Right", "l"}, true, (*UI).nextView},
+	{"up", "Move up", navigableViews, []string{"Up", "k"}, true, (*UI).moveUp},
+	{"down", "Move down", navigableViews, []string{"Down", "j"}, true, (*UI).moveDown},
+	{"top", "First item", navigableViews, []string{"Home", "gg"}, false, (*UI).moveTop},
+	{"bottom", "Last item", navigableViews, []string{"End", "G"}, false, (*UI).moveBottom},
+	{"page-up", "Page up", navigableViews, []string{"PgUp"}, false, (*UI).pageUp},
+	{"page-down", "Page down", navigableViews, []string{"PgDn"}, false, (*UI).pageDown},
+	{"refresh", "Refresh", navigableViews, []string{"F5"}, true, (*UI).refreshViews},
+	{"grub", "Update GRUB", navigableViews, []string{"ctrl+g"}, true, (*UI).updateGrub},
+	{"balance", "Btrfs balance", navigableViews, []string{"b"}, true, (*UI).executeBtrfsBalance},
+	{"convert", "Convert profiles", navigableViews, []string{"c"}, true, (*UI).convertProfiles},
+	{"quota", "Quota", navigableViews, []string{"u"}, true, (*UI).toggleQuota},
+	{"help", "Help", navigableViews, []string{"?"}, true, (*UI).showHelp},
+	{"history", "Operation history", navigableViews, []string{"H"}, false, (*UI).showHistory},
+	{"create", "Create snapshot", []string{viewSubvolumes}, []string{"t"}, true, (*UI).createSnapshot},
+	{"snapshot-all", "Snapshot all", []string{viewSubvolumes}, []string{"T"}, true, (*UI).snapshotAll},
+	{"delete", "Remove snapshot(s)", []string{viewSnapshots}, []string{"r"}, true, (*UI).deleteSnapshot},
+	{"delete-group", "Remove group", []string{viewSnapshots}, []string{"R"}, false, (*UI).deleteGroup},
+	{"rollback-group", "Roll back group", []string{viewSnapshots}, []string{"B"}, false, (*UI).rollbackGroup},
+	{"sort", "Sort column", []string{viewSnapshots}, []string{"s"}, true, (*UI).cycleSort},
+	{"reverse-sort", "Reverse sort", []string{viewSnapshots}, []string{"S"}, true, (*UI).reverseSort},
+	{"mark", "Mark", []string{viewSnapshots}, []string{"Space"}, true, (*UI).toggleMark},
+	{"mark-range", "Mark range", []string{viewSnapshots}, []string{"v"}, true, (*UI).markRange},
+	{"mark-older", "Mark older", []string{viewSnapshots}, []string{"o"}, true, (*UI).markOlder},
+	{"clear-marks", "Unmark", []string{viewSnapshots}, []string{"x"}, true, (*UI).clearMarks},
+	{"pin", "Pin/unpin", []string{viewSnapshots}, []string{"P"}, false, (*UI).togglePin},
+	{"search", "Search", listViews, []string{"/"}, true, (*UI).search},
+	{"next-match", "Next match", listViews, []string{"n"}, true, (*UI).nextMatch},
+	{"prev-match", "Previous match", listViews, []string{"N"}, false, (*UI).prevMatch},
+	{"filter", "Filter", listViews, []string{"f"}, true, (*UI).filterItems},
+	{"add-device", "Add device", []string{viewDevices}, []string{"a"}, true, (*UI).addDevice},
+	{"remove-device", "Remove device", []string{viewDevices}, []string{"d"}, true, (*UI).removeDevice},
+	{"replace-device", "Replace device", []string{viewDevices}, []string{"p"}, true, (*UI).replaceDevice},
+	{"reset-stats", "Reset error counters", []string{viewHealth}, []string{"z"}, true, (*UI).resetDeviceStats},
+}
+
+// namedKeys maps key names usable in bindings to gocui keys
+var namedKeys = map[string]gocui.Key{
+	"Up": gocui.KeyArrowUp, "Down": gocui.KeyArrowDown, "Left": gocui.KeyArrowLeft, "Right": gocui.KeyArrowRight,
+	"PgUp": gocui.KeyPgup, "PgDn": gocui.KeyPgdn, "Home": gocui.KeyHome, "End": gocui.KeyEnd,
+	"Insert": gocui.KeyInsert, "Delete": gocui.KeyDelete, "Space": gocui.KeySpace, "Tab": gocui.KeyTab,
+	"Enter": gocui.KeyEnter, "Backspace": gocui.KeyBackspace2,
+	"F1": gocui.KeyF1, "F2": gocui.KeyF2, "F3": gocui.KeyF3, "F4": gocui.KeyF4, "F5": gocui.KeyF5, "F6": gocui.KeyF6,
+	"F7": gocui.KeyF7, "F8": gocui.KeyF8, "F9": gocui.KeyF9, "F10": gocui.KeyF10, "F11": gocui.KeyF11, "F12": gocui.KeyF12,
+}
+
+// keyLabels are shorter names of keys in the hotkeys bar
+var keyLabels = map[string]string{"Up": "↑", "Down": "↓", "Left": "←", "Right": "→"}
+
+// key is a single key press with its canonical name
+type key struct {
+	name string
+	// code is a rune for characters or a gocui.Key for special keys
+	code interface{}
+}
+
+// keySequence is one or more keys pressed in a row, like "gg"
+type keySequence []key
+
+// String formats the sequence as it is written in the configuration file
+func (s keySequence) String() string {
+	var b strings.Builder
+	for _, k := range s {
+		b.WriteString(k.name)
+	}
+	return b.String()
+}
+
+// label formats the sequence for the hotkeys bar
+func (s keySequence) label() string {
+	if len(s) == 1 {
+		if label, found := keyLabels[s[0].name]; found {
+			return label
+		}
+	}
+	return s.String()
+}
+
+// hasPrefix reports whether the sequence starts with prefix
+func (s keySequence) hasPrefix(prefix keySequence) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i].name != prefix[i].name {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseKeySequence parses a key name such as "j", "PgDn", "ctrl+r" or a sequence of characters such as "gg"
+func ParseKeySequence(text string) (keySequence, error) {
+	text = strings.TrimSpace(text)
+	for name, code := range namedKeys {
+		if strings.EqualFold(name, text) {
+			return keySequence{{name: name, code: code}}, nil
+		}
+	}
+	lower := strings.ToLower(text)
+	if strings.HasPrefix(lower, "ctrl+") && len(lower) == 6 && lower[5] >= 'a' && lower[5] <= 'z' {
+		return keySequence{{name: "ctrl+" + lower[5:], code: gocui.KeyCtrlA + gocui.Key(lower[5]-'a')}}, nil
+	}
+
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	// Longer words starting with an uppercase letter are meant as key names
+	if len(runes) > 2 && unicode.IsUpper(runes[0]) {
+		return nil, fmt.Errorf("unknown key %q", text)
+	}
+	sequence := make(keySequence, 0, len(runes))
+	for _, r := range runes {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return nil, fmt.Errorf("invalid key %q, use Space for the space bar", text)
+		}
+		sequence = append(sequence, key{name: string(r), code: r})
+	}
+	return sequence, nil
+}
+
+// binding is a key sequence bound to an action
+type binding struct {
+	keys   keySequence
+	action *action
+}
+
+// keymap holds bindings of every view and the key sequences of every action
+type keymap struct {
+	views   map[string][]binding
+	actions map[string][]keySequence
+	// order lists all actions in the order they are shown
+	order []*action
+}
+
+// activeKeymap is used by the TUI, see SetKeymap
+var activeKeymap keymap
+
+// SetKeymap builds the keymap from default bindings and overrides keyed by action name.
+// Unknown actions, invalid keys and ambiguous bindings are reported as errors.
+func SetKeymap(overrides map[string][]string) error {
+	for name := range overrides {
+		if findAction(name) == nil {
+			return fmt.Errorf("unknown action %q in key bindings", name)
+		}
+	}
+
+	km := keymap{views: make(map[string][]binding), actions: make(map[string][]keySequence)}
+	for i := range actions {
+		a := &actions[i]
+		km.order = append(km.order, a)
+		keys, found := overrides[a.name]
+		if !found {
+			keys = a.keys
+		}
+		for _, text := range keys {
+			sequence, err := ParseKeySequence(text)
+			if err != nil {
+				return fmt.Errorf("invalid key binding of %s: %v", a.name, err)
+			}
+			for _, view := range a.views {
+				for _, other := range km.views[view] {
+					if sequence.hasPrefix(other.keys) || other.keys.hasPrefix(sequence) {
+						return fmt.Errorf("key %s of %s conflicts with %s of %s in %s view",
+							sequence, a.name, other.keys, other.action.name, view)
+					}
+				}
+				km.views[view] = append(km.views[view], binding{keys: sequence, action: a})
+			}
+			km.actions[a.name] = append(km.actions[a.name], sequence)
+		}
+	}
+	activeKeymap = km
+	return nil
+}
+
+// findAction returns the action with the given name, or nil
+func findAction(name string) *action {
+	for i := range actions {
+		if actions[i].name == name {
+			return &actions[i]
+		}
+	}
+	return nil
+}
+
+// keyLabel returns the first key of an action for use in messages
+func keyLabel(name string) string {
+	if sequences := activeKeymap.actions[name]; len(sequences) > 0 {
+		return sequences[0].label()
+	}
+	return "(unbound)"
+}
+
+// bindKeymap routes every key used in the active keymap to dispatchKey
+func (ui *UI) bindKeymap() error {
+	for view, bindings := range activeKeymap.views {
+		bound := make(map[string]bool)
+		for _, b := range bindings {
+			for _, k := range b.keys {
+				if bound[k.name] {
+					continue
+				}
+				bound[k.name] = true
+				name := k.name
+				if err := ui.gui.SetKeybinding(view, k.code, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+					return ui.dispatchKey(g, v, name)
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// dispatchKey runs the action bound to the pressed key, waiting for more keys
+// while the keys pressed so far only start a longer sequence
+func (ui *UI) dispatchKey(g *gocui.Gui, v *gocui.View, name string) error {
+	if v == nil {
+		return nil
+	}
+	// Keys pressed in another view do not continue a sequence here
+	if ui.pendingView != v.Name() {
+		ui.pendingKeys = nil
+	}
+	sequence := append(ui.pendingKeys, key{name: name})
+	ui.pendingKeys = nil
+
+	incomplete := false
+	for _, b := range activeKeymap.views[v.Name()] {
+		if len(b.keys) == len(sequence) && b.keys.hasPrefix(sequence) {
+			return b.action.handler(ui, g, v)
+		}
+		if b.keys.hasPrefix(sequence) {
+			incomplete = true
+		}
+	}
+	if incomplete {
+		ui.pendingKeys = sequence
+		ui.pendingView = v.Name()
+		return nil
+	}
+	// Start over with the last key if it does not continue the sequence
+	if len(sequence) > 1 {
+		return ui.dispatchKey(g, v, name)
+	}
+	return nil
+}
+
+// hotkeys describes the actions of a view shown in the hotkeys bar
+func (ui *UI) hotkeys(view string) string {
+	var entries []string
+	for _, b := range activeKeymap.views[view] {
+		if !b.action.bar {
+			continue
+		}
+		// Only the first key of each action fits in the bar
+		if activeKeymap.actions[b.action.name][0].String() != b.keys.String() {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s: %s", b.keys.label(), b.action.description))
+	}
+	return strings.Join(entries, " | ")
+}
+
+// helpText lists every binding, first those of all views and then those of each view
+func helpText() string {
+	var b strings.Builder
+	writeSection := func(title string, include func(a *action) bool) {
+		var lines strings.Builder
+		for _, a := range activeKeymap.order {
+			if !include(a) {
+				continue
+			}
+			var keys []string
+			for _, sequence := range activeKeymap.actions[a.name] {
+				keys = append(keys, sequence.String())
+			}
+			if len(keys) == 0 {
+				keys = []string{"(unbound)"}
+			}
+			fmt.Fprintf(&lines, "  %-16s %s\n", strings.Join(keys, ", "), a.description)
+		}
+		if lines.Len() > 0 {
+			fmt.Fprintf(&b, "%s\n%s\n", title, lines.String())
+		}
+	}
+
+	writeSection("All views", func(a *action) bool { return len(a.views) == len(navigableViews) })
+	for _, view := range navigableViews {
+		writeSection(viewTitles[view], func(a *action) bool {
+			if len(a.views) == len(navigableViews) {
+				return false
+			}
+			for _, v := range a.views {
+				if v == view {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	fmt.Fprintln(&b, "Dialogs")
+	fmt.Fprintln(&b, "  Tab              Move to the next button")
+	fmt.Fprintln(&b, "  Enter, click     Press the highlighted or clicked button")
+	fmt.Fprintln(&b, "  Esc              Close without acting")
+	fmt.Fprintln(&b, "  PgUp, PgDn       Scroll the message by a page")
+	fmt.Fprintln(&b, "  Mouse wheel      Scroll the message")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "Dialogs without input")
+	fmt.Fprintln(&b, "  ←/h, →/l         Move between buttons")
+	fmt.Fprintln(&b, "  y, n             Yes or No in confirmations")
+	fmt.Fprintln(&b, "  ↑/k, ↓/j         Scroll the message")
+	return b.String()
+}
+
+// viewTitles names navigable views in the help overlay
+var viewTitles = map[string]string{
+	viewFilesystems: "Filesystems",
+	viewSubvolumes:  "Subvolumes",
+	viewSnapshots:   "Snapshots",
+	viewDevices:     "Devices",
+	viewHealth:      "Health",
+	viewHistory:     "History",
+}
@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// descriptionXattr is the extended attribute holding a snapshot description
+const descriptionXattr = "user.butterfs.description"
+
+// sourceXattr is the extended attribute holding the subvolume a snapshot was taken of,
+// relative to the top-level subvolume, e.g. "_active/rootvol"
+const sourceXattr = "user.butterfs.source"
+
+// groupXattr is the extended attribute holding the ID of the group a snapshot belongs to
+const groupXattr = "user.butterfs.group"
+
+// pinnedXattr marks a snapshot as pinned, so butterfs does not delete it
+const pinnedXattr = "user.butterfs.pinned"
+
+// getXattr returns an extended attribute of path, or "" if it is not set
+func getXattr(path string, name string) (string, error) {
+	buf := make([]byte, 256)
+	for {
+		n, err := unix.Getxattr(path, name, buf)
+		switch {
+		case errors.Is(err, unix.ENODATA), errors.Is(err, unix.ENOTSUP):
+			return "", nil
+		case errors.Is(err, unix.ERANGE):
+			buf = make([]byte, len(buf)*4)
+			continue
+		case err != nil:
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+}
+
+// removeXattr removes an extended attribute of path, succeeding if it is not set
+func removeXattr(path string, name string) error {
+	if err := unix.Removexattr(path, name); err != nil && !errors.Is(err, unix.ENODATA) {
+		return err
+	}
+	return nil
+}
+
+// GetDescription returns the description stored on a snapshot, or "" if it has none
+func GetDescription(path string) (string, error) {
+	description, err := getXattr(path, descriptionXattr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read description: %v", err)
+	}
+	return description, nil
+}
+
+// SetDescription stores a description on a snapshot
+func SetDescription(path string, description string) (err error) {
+	defer func() { logOperation(fmt.Sprintf("set description of %s to %q", path, description), err) }()
+
+	if err = unix.Setxattr(path, descriptionXattr, []byte(description), 0); err != nil {
+		return fmt.Errorf("failed to save description: %v", err)
+	}
+	return nil
+}
+
+// IsPinned reports whether a snapshot is pinned
+func IsPinned(path string) (bool, error) {
+	value, err := getXattr(path, pinnedXattr)
+	if err != nil {
+		return false, fmt.Errorf("failed to read pin: %v", err)
+	}
+	return value != "", nil
+}
+
+// SetPinned pins or unpins a snapshot
+func SetPinned(path string, pinned bool) (err error) {
+	defer func() { logOperation(fmt.Sprintf("set pinned of %s to %t", path, pinned), err) }()
+
+	if pinned {
+		err = unix.Setxattr(path, pinnedXattr, []byte("1"), 0)
+	} else {
+		err = removeXattr(path, pinnedXattr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save pin: %v", err)
+	}
+	return nil
+}
+
+// GetSnapshotOrigin returns the source subvolume and group ID stored on a snapshot,
+// empty for snapshots not taken by butterfs or not taken as a group
+func GetSnapshotOrigin(path string) (source string, group string, err error) {
+	if source, err = getXattr(path, sourceXattr); err != nil {
+		return "", "", fmt.Errorf("failed to read source subvolume: %v", err)
+	}
+	if group, err = getXattr(path, groupXattr); err != nil {
+		return "", "", fmt.Errorf("failed to read group: %v", err)
+	}
+	return source, group, nil
+}
+
+// SetSnapshotOrigin stores the source subvolume and group ID on a snapshot. An empty
+// group removes a group ID the snapshot inherited from its source.
+func SetSnapshotOrigin(path string, source string, group string) (err error) {
+	defer func() { logOperation(fmt.Sprintf("set origin of %s to %s, group %q", path, source, group), err) }()
+
+	if err = unix.Setxattr(path, sourceXattr, []byte(source), 0); err != nil {
+		return fmt.Errorf("failed to save source subvolume: %v", err)
+	}
+	if group == "" {
+		err = removeXattr(path, groupXattr)
+	} else {
+		err = unix.Setxattr(path, groupXattr, []byte(group), 0)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save group: %v", err)
+	}
+	return nil
+}
+
+// clearSnapshotAttributes removes the butterfs attributes a subvolume inherited from
+// the snapshot it was created from, e.g. when a snapshot becomes the active subvolume
+func clearSnapshotAttributes(path string) (err error) {
+	defer func() { logOperation("clear snapshot attributes of "+path, err) }()
+
+	for _, name := range []string{descriptionXattr, sourceXattr, groupXattr, pinnedXattr} {
+		if err := removeXattr(path, name); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", name, err)
+		}
+	}
+	return nil
+}
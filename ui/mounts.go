@@ -0,0 +1,248 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// mountInfoPath is the mount table of the current mount namespace
+const mountInfoPath = "/proc/self/mountinfo"
+
+// Mount describes one entry of /proc/self/mountinfo
+type Mount struct {
+	MountPoint   string
+	Root         string
+	FSType       string
+	Source       string
+	SuperOptions string
+}
+
+// ParseMountInfo parses the content of /proc/self/mountinfo
+func ParseMountInfo(content string) []Mount {
+	var mounts []Mount
+	for _, line := range strings.Split(content, "\n") {
+		// Format: id parent major:minor root mountpoint options [optional...] - fstype source superoptions
+		fields := strings.Fields(line)
+		separator := -1
+		for i, field := range fields {
+			if field == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 5 || len(fields) < separator+4 {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Root:         unescapeMountField(fields[3]),
+			MountPoint:   unescapeMountField(fields[4]),
+			FSType:       fields[separator+1],
+			Source:       unescapeMountField(fields[separator+2]),
+			SuperOptions: fields[separator+3],
+		})
+	}
+	return mounts
+}
+
+// unescapeMountField decodes octal escapes such as \040 used for spaces in mountinfo
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			var value byte
+			if _, err := fmt.Sscanf(field[i+1:i+4], "%03o", &value); err == nil {
+				b.WriteByte(value)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// IsTopLevel reports whether the mount shows the top-level subvolume (subvolid=5)
+func (m Mount) IsTopLevel() bool {
+	for _, option := range strings.Split(m.SuperOptions, ",") {
+		if option == "subvolid=5" {
+			return true
+		}
+	}
+	return m.Root == "/"
+}
+
+// DiscoverBtrfs returns one mount point per mounted Btrfs filesystem,
+// preferring mounts of the top-level subvolume
+func DiscoverBtrfs() ([]string, error) {
+	content, err := os.ReadFile(mountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount table: %v", err)
+	}
+
+	var sources []string
+	chosen := make(map[string]Mount)
+	for _, mount := range ParseMountInfo(string(content)) {
+		if mount.FSType != "btrfs" {
+			continue
+		}
+		current, found := chosen[mount.Source]
+		if !found {
+			sources = append(sources, mount.Source)
+			chosen[mount.Source] = mount
+		} else if !current.IsTopLevel() && mount.IsTopLevel() {
+			chosen[mount.Source] = mount
+		}
+	}
+
+	paths := make([]string, 0, len(sources))
+	for _, source := range sources {
+		paths = append(paths, chosen[source].MountPoint)
+	}
+	return paths, nil
+}
+
+// uuidPattern matches a bare filesystem UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// TopLevelMounts resolves devices, UUIDs and subvolume mounts to a path of the
+// top-level subvolume, mounting it in a temporary directory when needed
+type TopLevelMounts struct {
+	mu   sync.Mutex
+	dirs []string
+}
+
+// Resolve returns a path where the top-level subvolume of the target filesystem is mounted.
+// Target may be a mount path, a block device, "UUID=<uuid>", "LABEL=<label>" or a bare UUID.
+func (t *TopLevelMounts) Resolve(target string) (string, error) {
+	content, err := os.ReadFile(mountInfoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read mount table: %v", err)
+	}
+	mounts := ParseMountInfo(string(content))
+
+	device, err := resolveDevice(target)
+	if err != nil {
+		return "", err
+	}
+
+	if device == "" {
+		// Target is a path, find the mount containing it
+		mount, found := containingMount(mounts, target)
+		if !found || mount.FSType != "btrfs" {
+			return target, nil
+		}
+		if mount.IsTopLevel() {
+			return target, nil
+		}
+		device = mount.Source
+	}
+
+	// Reuse an existing top-level mount of the same filesystem
+	for _, mount := range mounts {
+		if mount.FSType == "btrfs" && mount.IsTopLevel() && sameDevice(mount.Source, device) {
+			return mount.MountPoint, nil
+		}
+	}
+	return t.mount(device)
+}
+
+// mount mounts the top-level subvolume of device in a new temporary directory
+func (t *TopLevelMounts) mount(device string) (string, error) {
+	dir, err := os.MkdirTemp("", "butterfs-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create mount point: %v", err)
+	}
+	if err := syscall.Mount(device, dir, "btrfs", 0, "subvolid=5"); err != nil {
+		os.Remove(dir)
+		return "", fmt.Errorf("failed to mount top-level subvolume of %s: %v", device, err)
+	}
+
+	t.mu.Lock()
+	t.dirs = append(t.dirs, dir)
+	t.mu.Unlock()
+	return dir, nil
+}
+
+// Cleanup unmounts and removes all temporary mounts. It is safe to call more than once.
+func (t *TopLevelMounts) Cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, dir := range t.dirs {
+		// Lazy unmount succeeds even if a btrfs command still uses the mount
+		if err := syscall.Unmount(dir, syscall.MNT_DETACH); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to unmount %s: %v\n", dir, err)
+			continue
+		}
+		os.Remove(dir)
+	}
+	t.dirs = nil
+}
+
+// resolveDevice returns the block device named by target, or "" if target is a path
+func resolveDevice(target string) (string, error) {
+	switch {
+	case strings.HasPrefix(target, "UUID="):
+		return filepath.EvalSymlinks("/dev/disk/by-uuid/" + strings.TrimPrefix(target, "UUID="))
+	case strings.HasPrefix(target, "LABEL="):
+		return filepath.EvalSymlinks("/dev/disk/by-label/" + strings.TrimPrefix(target, "LABEL="))
+	case uuidPattern.MatchString(target):
+		if _, err := os.Stat(target); err != nil {
+			return filepath.EvalSymlinks("/dev/disk/by-uuid/" + target)
+		}
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeDevice != 0 {
+		return target, nil
+	}
+	return "", nil
+}
+
+// containingMount returns the mount with the longest mount point containing path
+func containingMount(mounts []Mount, path string) (Mount, bool) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return Mount{}, false
+	}
+	if resolved, err := filepath.EvalSymlinks(absolute); err == nil {
+		absolute = resolved
+	}
+
+	var best Mount
+	found := false
+	for _, mount := range mounts {
+		if absolute != mount.MountPoint && mount.MountPoint != "/" &&
+			!strings.HasPrefix(absolute, mount.MountPoint+"/") {
+			continue
+		}
+		// Later entries of the same mount point shadow earlier ones
+		if !found || len(mount.MountPoint) >= len(best.MountPoint) {
+			best = mount
+			found = true
+		}
+	}
+	return best, found
+}
+
+// sameDevice reports whether two device paths refer to the same device
+func sameDevice(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return a == b
+}
@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOperationLog is where operations and their errors are recorded unless configured otherwise
+const DefaultOperationLog = "/var/log/butterfs.log"
+
+// operationLogPath is the operation log file, empty if disabled with "log = none"
+var operationLogPath = DefaultOperationLog
+
+// operationLog is the open operation log, nil until OpenLogs is called
+var (
+	operationLog   *os.File
+	operationLogMu sync.Mutex
+)
+
+// OpenLogs opens the configured operation log and audit trail for appending, the
+// returned function closes them. Disabled logs are skipped.
+func OpenLogs() (func(), error) {
+	auditMu.Lock()
+	err := openAuditLog()
+	auditMu.Unlock()
+	if err != nil {
+		closeAuditLog()
+		return nil, err
+	}
+	if operationLogPath == "" {
+		return closeAuditLog, nil
+	}
+	file, err := os.OpenFile(operationLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		closeAuditLog()
+		return nil, fmt.Errorf("failed to open operation log: %v\nSet \"log = none\" in the configuration file to disable it", err)
+	}
+	operationLogMu.Lock()
+	operationLog = file
+	operationLogMu.Unlock()
+	return func() {
+		operationLogMu.Lock()
+		defer operationLogMu.Unlock()
+		operationLog.Close()
+		operationLog = nil
+		closeAuditLog()
+	}, nil
+}
+
+// logOperation records the outcome of an operation, e.g. "create snapshot _snapshots/rootvol-20250525-112410".
+// Command output in errors is kept, indented below the entry.
+func logOperation(operation string, err error) {
+	operationLogMu.Lock()
+	defer operationLogMu.Unlock()
+	if operationLog == nil {
+		return
+	}
+	entry := fmt.Sprintf("%s OK %s", time.Now().Format(time.RFC3339), operation)
+	if err != nil {
+		message := strings.ReplaceAll(strings.TrimSpace(err.Error()), "\n", "\n    ")
+		entry = fmt.Sprintf("%s FAILED %s: %s", time.Now().Format(time.RFC3339), operation, message)
+	}
+	// A failing log must not hide the operation result, which is shown anyway
+	fmt.Fprintln(operationLog, entry)
+}
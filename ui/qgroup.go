@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QgroupUsage holds referenced and exclusive sizes of a level 0 quota group
+type QgroupUsage struct {
+	Referenced uint64
+	Exclusive  uint64
+}
+
+// GetQgroups executes 'btrfs qgroup show' command and returns usage keyed by subvolume ID.
+// An error is returned when quotas are not enabled on the filesystem.
+func GetQgroups(path string) (map[uint64]QgroupUsage, error) {
+	output, err := runner.Output("btrfs", "qgroup", "show", "--raw", path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseQgroups(string(output)), nil
+}
+
+// ParseQgroups parses output of 'btrfs qgroup show --raw'
+func ParseQgroups(output string) map[uint64]QgroupUsage {
+	qgroups := make(map[uint64]QgroupUsage)
+	for _, line := range strings.Split(output, "\n") {
+		// Output format: <level>/<id> <rfer> <excl> [path]
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		level, id, found := strings.Cut(fields[0], "/")
+		if !found || level != "0" {
+			continue
+		}
+		subvolumeID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		referenced, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		exclusive, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		qgroups[subvolumeID] = QgroupUsage{Referenced: referenced, Exclusive: exclusive}
+	}
+	return qgroups
+}
+
+// EnableQuota enables quota groups on the filesystem
+func EnableQuota(path string) (err error) {
+	defer func() {
+		logOperation("enable quota on "+path, err)
+		audit("quota-enable", path, err)
+	}()
+
+	if output, err := runner.CombinedOutput("btrfs", "quota", "enable", path); err != nil {
+		return fmt.Errorf("failed to enable quota: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// DisableQuota disables quota groups on the filesystem
+func DisableQuota(path string) (err error) {
+	defer func() {
+		logOperation("disable quota on "+path, err)
+		audit("quota-disable", path, err)
+	}()
+
+	if output, err := runner.CombinedOutput("btrfs", "quota", "disable", path); err != nil {
+		return fmt.Errorf("failed to disable quota: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Runner executes external commands. It allows replacing btrfs-progs with canned
+// output, e.g. in tests on a machine without Btrfs.
+type Runner interface {
+	// Output runs a command and returns its standard output
+	Output(name string, args ...string) ([]byte, error)
+	// CombinedOutput runs a command and returns its standard output and error combined
+	CombinedOutput(name string, args ...string) ([]byte, error)
+}
+
+// runner is used by all backend functions to execute commands
+var runner Runner = execRunner{}
+
+// SetRunner replaces the runner used to execute commands
+func SetRunner(r Runner) {
+	runner = r
+}
+
+// execRunner executes commands with os/exec
+type execRunner struct{}
+
+func (execRunner) Output(name string, args ...string) ([]byte, error) {
+	output, err := exec.Command(name, args...).Output()
+	// Output captures stderr in the error, keep it in the message instead of just the exit status
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return output, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return output, err
+}
+
+func (execRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
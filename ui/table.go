@@ -0,0 +1,272 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotMeta holds snapshot attributes not included in subvolume listings,
+// valid for the subvolume ID and generation they were read at
+type snapshotMeta struct {
+	id          uint64
+	gen         uint64
+	readOnly    bool
+	description string
+	// group is the ID shared by snapshots taken together, empty for single snapshots
+	group string
+	// pinned snapshots are not deleted by butterfs
+	pinned bool
+}
+
+// loadSnapshotMeta reads attributes of the snapshot at path, leaving unreadable ones empty
+func loadSnapshotMeta(path string) snapshotMeta {
+	var meta snapshotMeta
+	meta.readOnly, _ = IsReadOnly(path)
+	meta.description, _ = GetDescription(path)
+	_, meta.group, _ = GetSnapshotOrigin(path)
+	meta.pinned, _ = IsPinned(path)
+	return meta
+}
+
+// snapshotColumn is one column of the snapshot table
+type snapshotColumn struct {
+	title string
+	width int
+	// right aligns the column, used for numbers
+	right bool
+	// priority decides which columns are dropped first when the view is narrow
+	priority int
+	value    func(snapshot string) string
+	// color optionally returns the theme color of a cell
+	color func(snapshot string) string
+}
+
+// minNameWidth is the narrowest name column before other columns are dropped
+const minNameWidth = 16
+
+// createdLayout is the format of the created column
+const createdLayout = "2006-01-02 15:04"
+
+// Sort keys of the snapshot table, cycled with 's'
+const (
+	sortListing = iota
+	sortCreated
+	sortName
+	sortID
+	sortGen
+	sortSize
+	sortKeyCount
+)
+
+// sortKeyNames names sort keys in view titles
+var sortKeyNames = []string{"listing", "created", "name", "ID", "gen", "size"}
+
+// snapshotColumns returns the columns fitting width in display order and the width left for names
+func (ui *UI) snapshotColumns(width int) ([]snapshotColumn, int) {
+	columns := []snapshotColumn{
+		{title: "Created", width: len(createdLayout), priority: 4, value: ui.snapshotCreated},
+		{title: "Age", width: 4, right: true, priority: 6, value: ui.snapshotAge, color: ui.snapshotAgeColor},
+		{title: "ID", width: 6, right: true, priority: 2, value: func(snapshot string) string {
+			return fmt.Sprintf("%d", ui.subvolumeByPath[snapshot].ID)
+		}},
+		{title: "Gen", width: 8, right: true, priority: 1, value: func(snapshot string) string {
+			return fmt.Sprintf("%d", ui.subvolumeByPath[snapshot].Gen)
+		}},
+		{title: "RO", width: 2, priority: 5, value: func(snapshot string) string {
+			if ui.snapshotMetas[snapshot].readOnly {
+				return "ro"
+			}
+			return ""
+		}, color: func(string) string { return theme.ReadOnly }},
+	}
+	if ui.qgroups != nil {
+		columns = append(columns,
+			snapshotColumn{title: "Rfer", width: 9, right: true, priority: 3, value: func(snapshot string) string {
+				return formatBytes(ui.snapshotUsage(snapshot).Referenced)
+			}},
+			snapshotColumn{title: "Excl", width: 9, right: true, priority: 7, value: func(snapshot string) string {
+				return formatBytes(ui.snapshotUsage(snapshot).Exclusive)
+			}})
+	} else {
+		columns = append(columns, snapshotColumn{title: "Excl", width: 9, right: true, priority: 7, value: ui.snapshotEstimate})
+	}
+	columns = append(columns, snapshotColumn{title: "Description", width: 16, priority: 0, value: func(snapshot string) string {
+		return ui.snapshotMetas[snapshot].description
+	}})
+
+	// Drop the least important columns until names get enough room
+	for len(columns) > 0 {
+		nameWidth := width
+		for _, column := range columns {
+			nameWidth -= column.width + 1
+		}
+		if nameWidth >= minNameWidth {
+			return columns, nameWidth
+		}
+		lowest := 0
+		for i, column := range columns {
+			if column.priority < columns[lowest].priority {
+				lowest = i
+			}
+		}
+		columns = append(columns[:lowest], columns[lowest+1:]...)
+	}
+	return nil, width
+}
+
+// formatSnapshot renders a snapshot as a row of the snapshot table.
+// Rows marked for deletion or pinned are colored as a whole, otherwise single cells may be colored.
+func (ui *UI) formatSnapshot(snapshot string, width int) string {
+	columns, nameWidth := ui.snapshotColumns(width)
+	marked := ui.snapshotsData.marked[snapshot]
+	pinned := ui.snapshotMetas[snapshot].pinned
+	var b strings.Builder
+	b.WriteString(fitWidth(strings.TrimPrefix(snapshot, snapshotPrefix+"/"), nameWidth))
+	for _, column := range columns {
+		b.WriteString(" ")
+		// Color after aligning so escape sequences don't count towards the width
+		cell := alignColumn(column.value(snapshot), column.width, column.right)
+		if column.color != nil && !marked && !pinned {
+			cell = colorize(column.color(snapshot), cell)
+		}
+		b.WriteString(cell)
+	}
+	if marked {
+		return colorize(theme.Marked, b.String())
+	}
+	if pinned {
+		return colorize(theme.Pinned, b.String())
+	}
+	return b.String()
+}
+
+// snapshotHeader renders the column titles of the snapshot table, marking the sort column
+func (ui *UI) snapshotHeader(width int) string {
+	columns, nameWidth := ui.snapshotColumns(width)
+	sorted := map[int]string{sortCreated: "Created", sortName: "Name", sortID: "ID", sortGen: "Gen", sortSize: "Excl"}[ui.sortKey]
+	title := func(name string) string {
+		if name != sorted {
+			return name
+		}
+		// Sizes sort largest first unless reversed
+		if ui.sortReverse != (ui.sortKey == sortSize) {
+			return name + "▼"
+		}
+		return name + "▲"
+	}
+
+	var b strings.Builder
+	b.WriteString(fitWidth(title("Name"), nameWidth))
+	for _, column := range columns {
+		b.WriteString(" ")
+		b.WriteString(alignColumn(title(column.title), column.width, column.right))
+	}
+	return b.String()
+}
+
+// alignColumn pads or truncates text to width, aligned left or right
+func alignColumn(text string, width int, right bool) string {
+	if right && len([]rune(text)) < width {
+		return strings.Repeat(" ", width-len([]rune(text))) + text
+	}
+	return fitWidth(text, width)
+}
+
+// snapshotCreated formats the creation time encoded in the snapshot name
+func (ui *UI) snapshotCreated(snapshot string) string {
+	created, ok := SnapshotTime(snapshot)
+	if !ok {
+		return "-"
+	}
+	return created.Format(createdLayout)
+}
+
+// snapshotAge formats the time since the snapshot was created
+func (ui *UI) snapshotAge(snapshot string) string {
+	created, ok := SnapshotTime(snapshot)
+	if !ok {
+		return "-"
+	}
+	return formatAge(time.Since(created))
+}
+
+// snapshotAgeColor returns the theme color for the age of a snapshot
+func (ui *UI) snapshotAgeColor(snapshot string) string {
+	created, ok := SnapshotTime(snapshot)
+	if !ok {
+		return ""
+	}
+	return ageColor(time.Since(created))
+}
+
+// formatAge formats a duration in its largest whole unit, e.g. "3d"
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	case age < 365*24*time.Hour:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	default:
+		return fmt.Sprintf("%dy", int(age.Hours()/24/365))
+	}
+}
+
+// snapshotEstimate formats a finished exclusive size estimate, without starting one
+func (ui *UI) snapshotEstimate(snapshot string) string {
+	path := fmt.Sprintf("%s/%s", defaultBtrfsPath, snapshot)
+	entry, ok := ui.estimates.Peek(path, ui.subvolumeByPath[snapshot].Gen)
+	if !ok {
+		return ""
+	}
+	return "~" + formatBytes(entry.estimate.Exclusive)
+}
+
+// snapshotSize returns the exclusive size of a snapshot if it is known
+func (ui *UI) snapshotSize(snapshot string) uint64 {
+	if ui.qgroups != nil {
+		return ui.snapshotUsage(snapshot).Exclusive
+	}
+	path := fmt.Sprintf("%s/%s", defaultBtrfsPath, snapshot)
+	if entry, ok := ui.estimates.Peek(path, ui.subvolumeByPath[snapshot].Gen); ok {
+		return entry.estimate.Exclusive
+	}
+	return 0
+}
+
+// sortSnapshots orders snapshots by the selected sort key, sizes largest first
+func (ui *UI) sortSnapshots(snapshots []string) {
+	var less func(a, b string) bool
+	switch ui.sortKey {
+	case sortCreated:
+		less = func(a, b string) bool {
+			ta, _ := SnapshotTime(a)
+			tb, _ := SnapshotTime(b)
+			return ta.Before(tb)
+		}
+	case sortName:
+		less = func(a, b string) bool { return a < b }
+	case sortID:
+		less = func(a, b string) bool { return ui.subvolumeByPath[a].ID < ui.subvolumeByPath[b].ID }
+	case sortGen:
+		less = func(a, b string) bool { return ui.subvolumeByPath[a].Gen < ui.subvolumeByPath[b].Gen }
+	case sortSize:
+		less = func(a, b string) bool { return ui.snapshotSize(a) > ui.snapshotSize(b) }
+	default:
+		if ui.sortReverse {
+			for i, j := 0, len(snapshots)-1; i < j; i, j = i+1, j-1 {
+				snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+			}
+		}
+		return
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if ui.sortReverse {
+			return less(snapshots[j], snapshots[i])
+		}
+		return less(snapshots[i], snapshots[j])
+	})
+}
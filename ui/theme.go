@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jroimartin/gocui"
+)
+
+// Theme holds the colors of the TUI. Content colors are ANSI escape
+// sequences, empty strings leave the text unstyled.
+type Theme struct {
+	// SelFg and SelBg color the selected line of the focused view
+	SelFg gocui.Attribute
+	SelBg gocui.Attribute
+	// Warning marks problems like low unallocated space or device errors
+	Warning string
+	// Marked colors snapshot rows marked for deletion
+	Marked   string
+	ReadOnly string
+	// Pinned colors snapshot rows protected from deletion
+	Pinned string
+	// Recent and Old color the age of snapshots younger than a day or older than oldSnapshotAge
+	Recent string
+	Old    string
+}
+
+// oldSnapshotAge is the age from which snapshots are shown as old
+const oldSnapshotAge = 30 * 24 * time.Hour
+
+// colorReset ends a colored text
+const colorReset = "\033[0m"
+
+// themes are the built-in themes selectable by name
+var themes = map[string]Theme{
+	"default": {
+		SelFg:    gocui.ColorBlack,
+		SelBg:    gocui.ColorGreen,
+		Warning:  "\033[31m",
+		Marked:   "\033[33m",
+		ReadOnly: "\033[36m",
+		Pinned:   "\033[34m",
+		Recent:   "\033[32m",
+		Old:      "\033[35m",
+	},
+	"high-contrast": {
+		SelFg:    gocui.ColorBlack | gocui.AttrBold,
+		SelBg:    gocui.ColorYellow,
+		Warning:  "\033[1;37;41m",
+		Marked:   "\033[1;33m",
+		ReadOnly: "\033[1;36m",
+		Pinned:   "\033[1;34m",
+		Recent:   "\033[1;32m",
+		Old:      "\033[1;35m",
+	},
+	"monochrome": {
+		SelFg:    gocui.ColorDefault | gocui.AttrReverse,
+		SelBg:    gocui.ColorDefault,
+		Warning:  "\033[1m",
+		Marked:   "\033[4m",
+		ReadOnly: "",
+		Pinned:   "\033[1m",
+		Recent:   "",
+		Old:      "",
+	},
+}
+
+// theme is the active theme
+var theme = themes["default"]
+
+// SetTheme selects a built-in theme by name
+func SetTheme(name string) error {
+	selected, found := themes[strings.ToLower(name)]
+	if !found {
+		names := make([]string, 0, len(themes))
+		for name := range themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	theme = selected
+	return nil
+}
+
+// colorize wraps text in an ANSI color, leaving it unchanged for an empty color
+func colorize(color string, text string) string {
+	if color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// ageColor returns the theme color for a snapshot of the given age
+func ageColor(age time.Duration) string {
+	switch {
+	case age < 24*time.Hour:
+		return theme.Recent
+	case age >= oldSnapshotAge:
+		return theme.Old
+	default:
+		return ""
+	}
+}
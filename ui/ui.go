@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"time"
@@ -21,42 +22,202 @@ func SetupPrefixes() {
 	}
 }
 
+// SetupOptions sets up optional behavior from environment variables and the configuration file
+func SetupOptions() error {
+	if value := os.Getenv("COMMIT_AFTER_DELETE"); value != "" {
+		commitAfterDelete = value == "1" || strings.EqualFold(value, "true")
+	}
+	if value := os.Getenv("BTRFS_BACKEND"); value != "" {
+		if err := SetBackend(value); err != nil {
+			return err
+		}
+	}
+
+	// NO_COLOR disables colors unless the configuration picks a theme, see https://no-color.org
+	if os.Getenv("NO_COLOR") != "" {
+		theme = themes["monochrome"]
+	}
+
+	config, err := LoadConfig(ConfigPath())
+	if err != nil {
+		return err
+	}
+	switch config.Log {
+	case "":
+	case "none":
+		operationLogPath = ""
+	default:
+		operationLogPath = config.Log
+	}
+	switch config.Audit {
+	case "":
+	case "none":
+		auditLogPath = ""
+	default:
+		auditLogPath = config.Audit
+	}
+	auditSyslog = config.Syslog
+	if config.Theme != "" {
+		if err := SetTheme(config.Theme); err != nil {
+			return err
+		}
+	}
+	return SetKeymap(config.Keys)
+}
+
+// cleanerPollInterval is how often pending subvolume cleanup is checked after deletion
+const cleanerPollInterval = 2 * time.Second
+
 const (
 	viewDiskInfo    = "diskInfo"
+	viewFilesystems = "filesystems"
 	viewSubvolumes  = "subvolumes"
 	viewSnapshots   = "snapshots"
 	viewSnapshotInfo = "snapshotInfo"
+	viewDevices     = "devices"
+	viewHealth      = "health"
+	viewHistory     = "history"
 	viewHotkeys     = "hotkeys"
 	viewDialog      = "dialog"
+	viewInput       = "input"
+	viewHelp        = "help"
 )
 
+// navigableViews lists views that can be focused, in switching order
+var navigableViews = []string{viewFilesystems, viewSubvolumes, viewSnapshots, viewDevices, viewHealth, viewHistory}
+
+// diskInfoHeight is the height of the disk info view including its frame
+const diskInfoHeight = 5
+
+// maxFilesystemsHeight limits the height of the filesystems view including its frame
+const maxFilesystemsHeight = 8
+
+// devicesHeight is the height of the devices and health views including their frames
+const devicesHeight = 8
+
+// historyHeight is the height of the history view including its frame
+const historyHeight = 8
+
+// replacePollInterval is how often the status of a running device replace is checked
+const replacePollInterval = 2 * time.Second
+
+// balancePollInterval is how often the status of a running balance is checked
+const balancePollInterval = 2 * time.Second
+
 type UI struct {
 	gui *gocui.Gui
 	currentView string
+	// filesystems lists mount paths of all monitored filesystems
+	filesystems []string
+	filesystemsData *ViewData
+	// filesystemStates keeps subvolume and snapshot lists of each filesystem separate
+	filesystemStates map[string]*filesystemState
 	subvolumesData *ViewData
 	snapshotsData *ViewData
+	// subvolumes caches the subvolume listing of the current filesystem until the next refresh
+	subvolumes []Subvolume
+	subvolumesErr error
+	subvolumeByPath map[string]Subvolume
+	snapshotMetas map[string]snapshotMeta
+	// snapshotInfos memoizes subvolume information by full path
+	snapshotInfos map[string]snapshotInfoEntry
+	// qgroups holds quota group usage keyed by subvolume ID, nil when quotas are disabled
+	qgroups map[uint64]QgroupUsage
+	subvolumeIDs map[string]uint64
+	// sortKey orders the snapshot table, see sortKeyNames
+	sortKey int
+	sortReverse bool
+	// pendingKeys are keys pressed so far of a multi-key binding like "gg" in pendingView
+	pendingKeys keySequence
+	pendingView string
+	// searchQuery is the last submitted search, used to jump between matches
+	searchQuery string
+	// dialog is the open modal dialog, nil if none
+	dialog *dialog
+	estimates *estimateCache
+	devicesData *ViewData
+	devices map[string]Device
+	healthData *ViewData
+	deviceStats map[string]DeviceStats
+	// historyData holds the latest audit trail entries, newest first
+	historyData *ViewData
+}
+
+// filesystemState holds per-filesystem list state and progress of background operations
+type filesystemState struct {
+	subvolumesData *ViewData
+	snapshotsData  *ViewData
+	// pendingCleanup is the number of deleted subvolumes the cleaner has not yet removed
+	pendingCleanup int
+	// replaceStatus is the last status line of a device replace, empty if none was started
+	replaceStatus string
+	// removeStatus is the state of the last background device removal, empty if none was started
+	removeStatus string
+	// balanceStatus is the progress of a running background balance, empty if none
+	balanceStatus string
+	// watching holds the background operations being polled, by name
+	watching map[string]bool
 }
 
-func Run(btrfsPath string) error {
-	defaultBtrfsPath = btrfsPath
+// snapshotInfoEntry is subvolume information valid for one generation of the subvolume
+type snapshotInfoEntry struct {
+	gen  uint64
+	info string
+}
+
+// Run starts the TUI for one or more Btrfs filesystems, the first one is selected initially.
+// It returns when the user quits or interrupt is closed.
+func Run(interrupt <-chan struct{}, btrfsPaths ...string) error {
+	if len(btrfsPaths) == 0 {
+		return fmt.Errorf("no btrfs filesystem given")
+	}
 	gui, err := gocui.NewGui(gocui.OutputNormal)
 	if err != nil {
 		return fmt.Errorf("failed to create gui: %v", err)
 	}
 	defer gui.Close()
 
+	// Leave the main loop when interrupted, so the terminal is restored as on quit
+	go func() {
+		<-interrupt
+		gui.Update(func(g *gocui.Gui) error { return gocui.ErrQuit })
+	}()
+
 	ui := &UI{
 		gui: gui,
 		currentView: viewSubvolumes,
-		subvolumesData: NewViewData(),
-		snapshotsData: NewViewData(),
+		filesystems: btrfsPaths,
+		filesystemsData: NewViewData(),
+		filesystemStates: make(map[string]*filesystemState),
+		snapshotInfos: make(map[string]snapshotInfoEntry),
+		estimates: newEstimateCache(),
+		devicesData: NewViewData(),
+		healthData: NewViewData(),
+		historyData: NewViewData(),
 	}
+	ui.filesystemsData.SetItems(btrfsPaths)
+	ui.selectFilesystem(btrfsPaths[0])
+	ui.devicesData.format = ui.formatDevice
+	ui.healthData.format = ui.formatHealth
+	ui.historyData.format = fitWidth
+	gui.InputEsc = true
+	gui.Mouse = true
 	gui.SetManager(ui)
 
 	if err := ui.setKeyBindings(); err != nil {
 		return fmt.Errorf("failed to set key bindings: %v", err)
 	}
 
+	// Operations finishing in the background show up in the history pane as well
+	auditMu.Lock()
+	auditHook = func() { gui.Update(func(g *gocui.Gui) error { ui.updateHistory(); return nil }) }
+	auditMu.Unlock()
+	defer func() {
+		auditMu.Lock()
+		auditHook = nil
+		auditMu.Unlock()
+	}()
+
 	if err := gui.MainLoop(); err != nil && err != gocui.ErrQuit {
 		return fmt.Errorf("main loop failed: %v", err)
 	}
@@ -68,45 +229,62 @@ func (ui *UI) Layout(gui *gocui.Gui) error {
 	maxX, maxY := gui.Size()
 
 	// Disk info view - top
-	if v, err := gui.SetView(viewDiskInfo, 0, 0, maxX-1, 2); err != nil {
+	if v, err := gui.SetView(viewDiskInfo, 0, 0, maxX-1, diskInfoHeight-1); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
-		v.Title = "Disk Info"
+		v.Title = "Disk Info: " + defaultBtrfsPath
 		v.Frame = true
 	}
 
+	// Filesystems view - left, above subvolumes
+	filesystemsHeight := len(ui.filesystems) + 2
+	if filesystemsHeight > maxFilesystemsHeight {
+		filesystemsHeight = maxFilesystemsHeight
+	}
+	if v, err := gui.SetView(viewFilesystems, 0, diskInfoHeight, (maxX/5)-1, diskInfoHeight+filesystemsHeight-1); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Filesystems"
+		v.Highlight = false  // Inactive view
+		v.SelBgColor = theme.SelBg
+		v.SelFgColor = theme.SelFg
+		v.Frame = true
+		ui.filesystemsData.Render(v)
+	}
+
 	// Subvolumes view - left
-	if v, err := gui.SetView(viewSubvolumes, 0, 3, (maxX/5)-1, maxY-3); err != nil {
+	if v, err := gui.SetView(viewSubvolumes, 0, diskInfoHeight+filesystemsHeight, (maxX/5)-1, maxY-3); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
 		v.Title = "Subvolumes"
 		v.Highlight = true  // Initial view
-		v.SelBgColor = gocui.ColorGreen
-		v.SelFgColor = gocui.ColorBlack
+		v.SelBgColor = theme.SelBg
+		v.SelFgColor = theme.SelFg
 		v.Frame = true
 		if _, err := ui.gui.SetCurrentView(viewSubvolumes); err != nil {
 			return err
 		}
-		ui.UpdateViewContent()
+		ui.refresh()
 	}
 
 	// Snapshots view - middle
-	if v, err := gui.SetView(viewSnapshots, maxX/5, 3, (maxX*2/4)-1, maxY-3); err != nil {
+	if v, err := gui.SetView(viewSnapshots, maxX/5, diskInfoHeight, (maxX*2/4)-1, maxY-3); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
 		v.Title = "Snapshots"
 		v.Highlight = false  // Inactive view
-		v.SelBgColor = gocui.ColorGreen
-		v.SelFgColor = gocui.ColorBlack
+		v.SelBgColor = theme.SelBg
+		v.SelFgColor = theme.SelFg
 		v.Frame = true
 		ui.UpdateViewContent()
 	}
 
 	// Snapshot info view - right
-	if v, err := gui.SetView(viewSnapshotInfo, (maxX*2/4), 3, maxX-1, maxY-3); err != nil {
+	if v, err := gui.SetView(viewSnapshotInfo, (maxX*2/4), diskInfoHeight, maxX-1, maxY-3-devicesHeight-historyHeight); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
@@ -116,6 +294,45 @@ func (ui *UI) Layout(gui *gocui.Gui) error {
 		ui.UpdateViewContent()
 	}
 
+	// History view - right, above devices
+	if v, err := gui.SetView(viewHistory, (maxX*2/4), maxY-2-devicesHeight-historyHeight, maxX-1, maxY-3-devicesHeight); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "History"
+		v.Highlight = false  // Inactive view
+		v.SelBgColor = theme.SelBg
+		v.SelFgColor = theme.SelFg
+		v.Frame = true
+		ui.updateHistory()
+	}
+
+	// Devices view - bottom right
+	if v, err := gui.SetView(viewDevices, (maxX*2/4), maxY-2-devicesHeight, (maxX*3/4)-1, maxY-3); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Devices"
+		v.Highlight = false  // Inactive view
+		v.SelBgColor = theme.SelBg
+		v.SelFgColor = theme.SelFg
+		v.Frame = true
+		ui.updateDevices()
+	}
+
+	// Health view - bottom right, next to devices
+	if v, err := gui.SetView(viewHealth, (maxX*3/4), maxY-2-devicesHeight, maxX-1, maxY-3); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Health (W/R/F/C/G errors)"
+		v.Highlight = false  // Inactive view
+		v.SelBgColor = theme.SelBg
+		v.SelFgColor = theme.SelFg
+		v.Frame = true
+		ui.updateHealth()
+	}
+
 	// Hotkeys view - bottom
 	if v, err := gui.SetView(viewHotkeys, 0, maxY-3, maxX-1, maxY-1); err != nil {
 		if err != gocui.ErrUnknownView {
@@ -127,54 +344,137 @@ func (ui *UI) Layout(gui *gocui.Gui) error {
 		ui.updateHotkeys()
 	}
 
-	return nil
+	// Dialogs follow terminal size changes
+	return ui.layoutDialog()
 }
 
 func (ui *UI) setKeyBindings() error {
-	// Quit
-	if err := ui.gui.SetKeybinding("", 'q', gocui.ModNone, quit); err != nil {
-		return err
-	}
-
-	// Create snapshot
-	if err := ui.gui.SetKeybinding(viewSubvolumes, 't', gocui.ModNone, ui.createSnapshot); err != nil {
-		return err
-	}
-
-	// Delete snapshot
-	if err := ui.gui.SetKeybinding(viewSnapshots, 'r', gocui.ModNone, ui.deleteSnapshot); err != nil {
-		return err
+	// Use default bindings if no configuration was loaded
+	if activeKeymap.views == nil {
+		if err := SetKeymap(nil); err != nil {
+			return err
+		}
 	}
 
-	// Navigation between views
-	if err := ui.gui.SetKeybinding("", gocui.KeyArrowLeft, gocui.ModNone, ui.prevView); err != nil {
-		return err
-	}
-	if err := ui.gui.SetKeybinding("", gocui.KeyArrowRight, gocui.ModNone, ui.nextView); err != nil {
+	// Keys are bound in navigable views only, so they do not fire inside dialogs
+	if err := ui.bindKeymap(); err != nil {
 		return err
 	}
 
-	// Navigation within views
-	views := []string{viewSubvolumes, viewSnapshots}
-	for _, view := range views {
-		if err := ui.gui.SetKeybinding(view, gocui.KeyArrowUp, gocui.ModNone, ui.moveUp); err != nil {
+	// Mouse clicks focus views and select items, the wheel moves through lists
+	for _, view := range navigableViews {
+		if err := ui.gui.SetKeybinding(view, gocui.MouseLeft, gocui.ModNone, ui.clickView); err != nil {
+			return err
+		}
+		if err := ui.gui.SetKeybinding(view, gocui.MouseWheelUp, gocui.ModNone, ui.scrollUp); err != nil {
 			return err
 		}
-		if err := ui.gui.SetKeybinding(view, gocui.KeyArrowDown, gocui.ModNone, ui.moveDown); err != nil {
+		if err := ui.gui.SetKeybinding(view, gocui.MouseWheelDown, gocui.ModNone, ui.scrollDown); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	// Update GRUB configuration
-	if err := ui.gui.SetKeybinding("", 'g', gocui.ModNone, ui.updateGrub); err != nil {
-		return err
+// selectFilesystem makes path the current filesystem, restoring its list state
+func (ui *UI) selectFilesystem(path string) {
+	state, found := ui.filesystemStates[path]
+	if !found {
+		state = &filesystemState{
+			subvolumesData: NewViewData(),
+			snapshotsData:  NewViewData(),
+			watching:       make(map[string]bool),
+		}
+		state.snapshotsData.format = ui.formatSnapshot
+		state.snapshotsData.header = ui.snapshotHeader
+		ui.filesystemStates[path] = state
+		ui.watchChanges(path)
 	}
 
-	// Execute btrfs balance
-	if err := ui.gui.SetKeybinding("", 'b', gocui.ModNone, ui.executeBtrfsBalance); err != nil {
-		return err
+	defaultBtrfsPath = path
+	ui.subvolumesData = state.subvolumesData
+	ui.snapshotsData = state.snapshotsData
+	ui.snapshotMetas = nil
+}
+
+// currentState returns the state of the current filesystem
+func (ui *UI) currentState() *filesystemState {
+	return ui.filesystemStates[defaultBtrfsPath]
+}
+
+// watchOperation polls a background operation on the current filesystem until poll
+// reports it done. Polling continues on that filesystem when another one is selected,
+// and only one poller per operation and filesystem runs. The update returned by poll
+// is applied to the filesystem state on the main loop, redraw shows it if the
+// filesystem is still current.
+func (ui *UI) watchOperation(operation string, interval time.Duration,
+	poll func(path string) (bool, func(state *filesystemState)), redraw func()) {
+	path := defaultBtrfsPath
+	state := ui.currentState()
+	if state.watching[operation] {
+		return
 	}
+	state.watching[operation] = true
+
+	go func() {
+		for {
+			done, update := poll(path)
+			ui.gui.Update(func(g *gocui.Gui) error {
+				update(state)
+				if done {
+					state.watching[operation] = false
+				}
+				if path == defaultBtrfsPath {
+					redraw()
+				}
+				return nil
+			})
+			if done {
+				return
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// watchChanges refreshes the views in the background whenever subvolumes of
+// the filesystem at path change, e.g. snapshots created by a timer
+func (ui *UI) watchChanges(path string) {
+	go func() {
+		// While listings fail, F5 still refreshes on demand
+		WatchSubvolumes(path, func() {
+			ui.gui.Update(func(g *gocui.Gui) error {
+				if path == defaultBtrfsPath {
+					ui.refresh()
+				}
+				return nil
+			})
+		})
+	}()
+}
 
+// switchFilesystem selects another filesystem and refreshes all views
+func (ui *UI) switchFilesystem(path string) {
+	if path == "" || path == defaultBtrfsPath {
+		return
+	}
+	ui.selectFilesystem(path)
+	if diskView, err := ui.gui.View(viewDiskInfo); err == nil {
+		diskView.Title = "Disk Info: " + path
+	}
+	ui.refresh()
+	ui.updateDevices()
+}
+
+// refreshViews reloads cached data of the current filesystem on demand
+func (ui *UI) refreshViews(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	// Read all snapshot attributes again, e.g. a read-only flag changed elsewhere
+	ui.snapshotMetas = nil
+	ui.refresh()
+	ui.updateDevices()
 	return nil
 }
 
@@ -184,14 +484,132 @@ func (ui *UI) executeBtrfsBalance(g *gocui.Gui, v *gocui.View) error {
 	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
 		output, err := ExecuteBtrfsBalance(defaultBtrfsPath)
 		if err != nil {
-			return ui.showDialog(fmt.Sprintf("Error executing btrfs balance:\n%v", err))
+			return ui.showDialog("Balance", fmt.Sprintf("Error executing btrfs balance:\n%v", err))
+		}
+		return ui.showDialog("Balance", fmt.Sprintf("Btrfs balance completed:\n%s", output))
+	})
+}
+
+// convertProfiles guides through converting data and metadata RAID profiles
+func (ui *UI) convertProfiles(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+
+	usage, err := GetFilesystemUsage(defaultBtrfsPath)
+	if err != nil {
+		return ui.showDialog("Convert Profiles", fmt.Sprintf("Error getting disk info:\n%v", err))
+	}
+	devices, err := GetDevices(defaultBtrfsPath)
+	if err != nil {
+		return ui.showDialog("Convert Profiles", fmt.Sprintf("Error getting devices:\n%v", err))
+	}
+
+	current := PlanConversion(usage, devices, "", "")
+	prompt := fmt.Sprintf("Current: data %s, metadata %s on %d device(s).\n"+
+		"Enter target data and metadata profiles, '-' keeps current (e.g. raid1 raid1).\n"+
+		"Profiles: %s",
+		current.DataFrom, current.MetadataFrom, len(devices), strings.Join(RaidProfileNames(), " "))
+
+	return ui.showInputDialog("Convert Profiles", prompt, func(value string) error {
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return nil
+		}
+		dataTo, metadataTo := fields[0], fields[0]
+		if len(fields) > 1 {
+			metadataTo = fields[1]
 		}
-		return ui.showDialog(fmt.Sprintf("Btrfs balance completed:\n%s", output))
+		if dataTo == "-" {
+			dataTo = ""
+		}
+		if metadataTo == "-" {
+			metadataTo = ""
+		}
+
+		plan := PlanConversion(usage, devices, dataTo, metadataTo)
+		if !plan.Feasible() {
+			return ui.showDialog("Convert Profiles", fmt.Sprintf("Conversion is not possible:\n%s", strings.Join(plan.Problems, "\n")))
+		}
+
+		message := fmt.Sprintf("Are you sure you want to convert profiles?\nData: %s -> %s\nMetadata: %s -> %s\n"+
+			"%s used, about %s available after conversion.\nThis operation may take a long time.",
+			plan.DataFrom, plan.DataTo, plan.MetadataFrom, plan.MetadataTo,
+			formatBytes(plan.Required), formatBytes(plan.Available))
+		if plan.ReducesMetadataRedundancy() {
+			message += fmt.Sprintf("\nWARNING: metadata as %s has no redundancy left, "+
+				"the conversion is forced.", plan.MetadataTo)
+		}
+		return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+			if err := StartConversion(defaultBtrfsPath, plan); err != nil {
+				return ui.showDialog("Convert Profiles", fmt.Sprintf("Error converting profiles:\n%v", err))
+			}
+			ui.watchBalance()
+			return nil
+		})
 	})
 }
 
-// isDialogVisible checks if a dialog window is currently displayed
+// watchBalance polls balance status in the background while a balance is running
+func (ui *UI) watchBalance() {
+	ui.watchOperation("balance", balancePollInterval, func(path string) (bool, func(*filesystemState)) {
+		status, running, err := GetBalanceStatus(path)
+		return err != nil || !running, func(state *filesystemState) { state.balanceStatus = status }
+	}, ui.updateDiskInfo)
+}
+
+// toggleQuota enables or disables quota groups on the filesystem
+func (ui *UI) toggleQuota(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+
+	if ui.qgroups != nil {
+		message := "Are you sure you want to disable quota groups?\nPer-snapshot sizes will no longer be available."
+		return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+			if err := DisableQuota(defaultBtrfsPath); err != nil {
+				return ui.showDialog("Quota", fmt.Sprintf("Error disabling quota:\n%v", err))
+			}
+			ui.refresh()
+			return nil
+		})
+	}
+
+	message := "Are you sure you want to enable quota groups?\nQuotas may slow down snapshot deletion and balance."
+	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+		if err := EnableQuota(defaultBtrfsPath); err != nil {
+			return ui.showDialog("Quota", fmt.Sprintf("Error enabling quota:\n%v", err))
+		}
+		ui.refresh()
+		return nil
+	})
+}
+
+// cycleSort sorts the snapshot table by the next column
+func (ui *UI) cycleSort(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	ui.sortKey = (ui.sortKey + 1) % sortKeyCount
+	ui.UpdateViewContent()
+	return nil
+}
+
+// reverseSort reverses the order of the snapshot table
+func (ui *UI) reverseSort(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	ui.sortReverse = !ui.sortReverse
+	ui.UpdateViewContent()
+	return nil
+}
+
+// isDialogVisible checks if a dialog window or the help overlay is currently displayed
 func (ui *UI) isDialogVisible() bool {
+	if _, err := ui.gui.View(viewHelp); err == nil {
+		return true
+	}
 	_, err := ui.gui.View(viewDialog)
 	return err == nil
 }
@@ -200,40 +618,15 @@ func (ui *UI) nextView(g *gocui.Gui, v *gocui.View) error {
 	if ui.isDialogVisible() {
 		return nil
 	}
-	views := []string{viewSubvolumes, viewSnapshots}
+	views := navigableViews
 	for i, view := range views {
 		if view == ui.currentView {
 			if i < len(views)-1 {
-				ui.currentView = views[i+1]
-			} else {
-				ui.currentView = views[0]
+				return ui.focusView(views[i+1])
 			}
-			break
+			return ui.focusView(views[0])
 		}
 	}
-	if _, err := g.SetCurrentView(ui.currentView); err != nil {
-		return err
-	}
-
-	// Update highlight for current view
-	viewsList := []string{viewSubvolumes, viewSnapshots}
-	for _, viewName := range viewsList {
-		v, err := g.View(viewName)
-		if err != nil {
-			continue
-		}
-		v.Highlight = (viewName == ui.currentView)
-	}
-
-	// If switched to snapshots, update information
-	if ui.currentView == viewSnapshots {
-		ui.UpdateViewContent()
-	} else {
-		ui.updateSnapshotInfo()
-	}
-
-	// Update hotkeys display
-	ui.updateHotkeys()
 	return nil
 }
 
@@ -241,25 +634,29 @@ func (ui *UI) prevView(g *gocui.Gui, v *gocui.View) error {
 	if ui.isDialogVisible() {
 		return nil
 	}
-	views := []string{viewSubvolumes, viewSnapshots}
+	views := navigableViews
 	for i, view := range views {
 		if view == ui.currentView {
 			if i > 0 {
-				ui.currentView = views[i-1]
-			} else {
-				ui.currentView = views[len(views)-1]
+				return ui.focusView(views[i-1])
 			}
-			break
+			return ui.focusView(views[len(views)-1])
 		}
 	}
-	if _, err := g.SetCurrentView(ui.currentView); err != nil {
+	return nil
+}
+
+// focusView makes the navigable view current, highlighting it and updating dependent views
+func (ui *UI) focusView(name string) error {
+	ui.currentView = name
+	ui.pendingKeys = nil
+	if _, err := ui.gui.SetCurrentView(ui.currentView); err != nil {
 		return err
 	}
 
 	// Update highlight for current view
-	viewsList := []string{viewSubvolumes, viewSnapshots}
-	for _, viewName := range viewsList {
-		v, err := g.View(viewName)
+	for _, viewName := range navigableViews {
+		v, err := ui.gui.View(viewName)
 		if err != nil {
 			continue
 		}
@@ -278,52 +675,117 @@ func (ui *UI) prevView(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func (ui *UI) moveUp(g *gocui.Gui, v *gocui.View) error {
-	if v == nil || ui.isDialogVisible() {
+// clickView focuses the clicked view and selects the clicked item
+func (ui *UI) clickView(g *gocui.Gui, v *gocui.View) error {
+	data := ui.listData(v.Name())
+	if ui.isDialogVisible() {
+		// The click moved the cursor of the view, put it back on the selected item
+		if data != nil {
+			data.Render(v)
+		}
 		return nil
 	}
 
-	var data *ViewData
-	if v.Name() == viewSubvolumes {
-		data = ui.subvolumesData
-	} else if v.Name() == viewSnapshots {
-		data = ui.snapshotsData
-	} else {
+	_, row := v.Cursor()
+	if v.Name() != ui.currentView {
+		if err := ui.focusView(v.Name()); err != nil {
+			return err
+		}
+	}
+	if data == nil {
 		return nil
 	}
-
-	data.MoveUp()
+	if index := data.IndexAt(v, row); index >= 0 {
+		return ui.moveBy(v, index-data.selected)
+	}
 	data.Render(v)
+	return nil
+}
 
-	if v.Name() == viewSubvolumes {
-		ui.UpdateViewContent()
-	} else {
-		ui.updateSnapshotInfo()
+// scrollUp moves the cursor of the view under the mouse wheel up
+func (ui *UI) scrollUp(g *gocui.Gui, v *gocui.View) error {
+	return ui.moveBy(v, -1)
+}
+
+// scrollDown moves the cursor of the view under the mouse wheel down
+func (ui *UI) scrollDown(g *gocui.Gui, v *gocui.View) error {
+	return ui.moveBy(v, 1)
+}
+
+func (ui *UI) moveUp(g *gocui.Gui, v *gocui.View) error {
+	return ui.moveBy(v, -1)
+}
+
+func (ui *UI) moveDown(g *gocui.Gui, v *gocui.View) error {
+	return ui.moveBy(v, 1)
+}
+
+// moveTop moves the cursor to the first item
+func (ui *UI) moveTop(g *gocui.Gui, v *gocui.View) error {
+	return ui.moveBy(v, math.MinInt32)
+}
+
+// moveBottom moves the cursor to the last item
+func (ui *UI) moveBottom(g *gocui.Gui, v *gocui.View) error {
+	return ui.moveBy(v, math.MaxInt32)
+}
+
+// pageUp moves the cursor up by one screen
+func (ui *UI) pageUp(g *gocui.Gui, v *gocui.View) error {
+	if v == nil {
+		return nil
+	}
+	_, height := v.Size()
+	return ui.moveBy(v, -max(height-1, 1))
+}
+
+// pageDown moves the cursor down by one screen
+func (ui *UI) pageDown(g *gocui.Gui, v *gocui.View) error {
+	if v == nil {
+		return nil
+	}
+	_, height := v.Size()
+	return ui.moveBy(v, max(height-1, 1))
+}
+
+// listData returns the list data shown in the view, or nil
+func (ui *UI) listData(name string) *ViewData {
+	switch name {
+	case viewSubvolumes:
+		return ui.subvolumesData
+	case viewSnapshots:
+		return ui.snapshotsData
+	case viewDevices:
+		return ui.devicesData
+	case viewHealth:
+		return ui.healthData
+	case viewHistory:
+		return ui.historyData
+	case viewFilesystems:
+		return ui.filesystemsData
 	}
 	return nil
 }
 
-func (ui *UI) moveDown(g *gocui.Gui, v *gocui.View) error {
+// moveBy moves the cursor of the view by delta items and updates dependent views
+func (ui *UI) moveBy(v *gocui.View, delta int) error {
 	if v == nil || ui.isDialogVisible() {
 		return nil
 	}
-
-	var data *ViewData
-	if v.Name() == viewSubvolumes {
-		data = ui.subvolumesData
-	} else if v.Name() == viewSnapshots {
-		data = ui.snapshotsData
-	} else {
+	data := ui.listData(v.Name())
+	if data == nil {
 		return nil
 	}
 
-	data.MoveDown()
+	data.MoveBy(delta)
 	data.Render(v)
 
 	if v.Name() == viewSubvolumes {
 		ui.UpdateViewContent()
-	} else {
+	} else if v.Name() == viewSnapshots {
 		ui.updateSnapshotInfo()
+	} else if v.Name() == viewFilesystems {
+		ui.switchFilesystem(data.GetSelected())
 	}
 	return nil
 }
@@ -333,26 +795,337 @@ func (ui *UI) deleteSnapshot(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 
-	selectedSnapshot := ui.snapshotsData.GetSelected()
-	if selectedSnapshot == "" {
-		return nil
+	// Delete marked snapshots, or the selected one if nothing is marked
+	targets := ui.snapshotsData.GetMarked()
+	if len(targets) == 0 {
+		selectedSnapshot := ui.snapshotsData.GetSelected()
+		if selectedSnapshot == "" {
+			return nil
+		}
+		targets = []string{selectedSnapshot}
+	}
+
+	// Pinned snapshots are kept, say so instead of asking for nothing
+	targets, pinned := ui.withoutPinned(targets)
+	if len(targets) == 0 {
+		return ui.showDialog("Remove Snapshot", fmt.Sprintf("Pinned snapshots are not deleted, unpin them first:\n%s", strings.Join(pinned, "\n")))
 	}
 
 	// Create confirmation message
-	message := fmt.Sprintf("Are you sure you want to delete snapshot:\n%s?", selectedSnapshot)
+	var message string
+	if len(targets) == 1 {
+		message = fmt.Sprintf("Are you sure you want to delete snapshot:\n%s?", targets[0])
+	} else {
+		message = fmt.Sprintf("Are you sure you want to delete %d snapshots:\n%s",
+			len(targets), strings.Join(targets, "\n"))
+	}
+	message += keptMessage(pinned)
 
 	// Show confirmation dialog
 	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
-		// Create full path to snapshot
-		fullPath := fmt.Sprintf("%s/%s", defaultBtrfsPath, selectedSnapshot)
+		// Create full paths to snapshots
+		fullPaths := make([]string, 0, len(targets))
+		for _, target := range targets {
+			fullPaths = append(fullPaths, fmt.Sprintf("%s/%s", defaultBtrfsPath, target))
+		}
 
-		// Delete snapshot
-		if err := DeleteSnapshot(fullPath); err != nil {
-			return err
+		// Delete a single snapshot as before, batch otherwise
+		if len(fullPaths) == 1 {
+			if err := DeleteSnapshot(fullPaths[0]); err != nil {
+				// Errors returned from handlers would end the main loop
+				ui.refresh()
+				return ui.showDialog("Remove Snapshot", fmt.Sprintf("Error deleting %s:\n%v", targets[0], err))
+			}
+			ui.snapshotsData.ClearMarks()
+			ui.refresh()
+			ui.watchCleaner()
+			return nil
 		}
 
-		// Update display
+		results := DeleteSnapshots(fullPaths)
+		ui.snapshotsData.ClearMarks()
+		ui.refresh()
+		ui.watchCleaner()
+		return ui.showDialog("Remove Snapshots", deleteSummary(targets, results))
+	})
+}
+
+// withoutPinned splits snapshots into those that may be deleted and pinned ones
+func (ui *UI) withoutPinned(snapshots []string) ([]string, []string) {
+	var unpinned, pinned []string
+	for _, snapshot := range snapshots {
+		if ui.snapshotMetas[snapshot].pinned {
+			pinned = append(pinned, snapshot)
+		} else {
+			unpinned = append(unpinned, snapshot)
+		}
+	}
+	return unpinned, pinned
+}
+
+// keptMessage tells which pinned snapshots a deletion leaves alone, empty if none
+func keptMessage(pinned []string) string {
+	if len(pinned) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nPinned snapshots are kept:\n%s", strings.Join(pinned, "\n"))
+}
+
+// watchCleaner polls deleted subvolumes in the background until the cleaner
+// has removed all of them, then refreshes disk usage
+func (ui *UI) watchCleaner() {
+	ui.watchOperation("cleaner", cleanerPollInterval, func(path string) (bool, func(*filesystemState)) {
+		deleted, err := ListDeletedSubvolumes(path)
+		return err != nil || len(deleted) == 0, func(state *filesystemState) { state.pendingCleanup = len(deleted) }
+	}, ui.updateDiskInfo)
+}
+
+// deleteSummary reports the outcome of deleting several snapshots
+func deleteSummary(targets []string, results []DeleteResult) string {
+	var summary strings.Builder
+	failed := 0
+	for i, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(&summary, "FAIL %s: %v\n", targets[i], result.Err)
+		} else {
+			fmt.Fprintf(&summary, "OK   %s\n", targets[i])
+		}
+	}
+	return fmt.Sprintf("Deleted %d of %d snapshots:\n%s", len(results)-failed, len(results), summary.String())
+}
+
+// selectedGroup returns the snapshots of all subvolumes taken together with the selected one
+func (ui *UI) selectedGroup() []string {
+	_, snapshots := splitSubvolumes(ui.subvolumes)
+	return GroupMembers(snapshots, ui.snapshotMetas[ui.snapshotsData.GetSelected()].group, func(snapshot string) string {
+		return ui.snapshotMetas[snapshot].group
+	})
+}
+
+// deleteGroup deletes the group of the selected snapshot
+func (ui *UI) deleteGroup(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	members, pinned := ui.withoutPinned(ui.selectedGroup())
+	if len(members) == 0 {
+		if len(pinned) > 0 {
+			return ui.showDialog("Remove Group", fmt.Sprintf("Pinned snapshots are not deleted, unpin them first:\n%s", strings.Join(pinned, "\n")))
+		}
+		return nil
+	}
+
+	message := fmt.Sprintf("Are you sure you want to delete the group of %d snapshots:\n%s",
+		len(members), strings.Join(members, "\n")) + keptMessage(pinned)
+	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+		fullPaths := make([]string, 0, len(members))
+		for _, member := range members {
+			fullPaths = append(fullPaths, fmt.Sprintf("%s/%s", defaultBtrfsPath, member))
+		}
+		results := DeleteSnapshots(fullPaths)
+		ui.snapshotsData.ClearMarks()
+		ui.refresh()
+		ui.watchCleaner()
+		return ui.showDialog("Remove Group", deleteSummary(members, results))
+	})
+}
+
+// rollbackGroup makes the group of the selected snapshot the active subvolumes
+func (ui *UI) rollbackGroup(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	members := ui.selectedGroup()
+	if len(members) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Are you sure you want to roll back %d subvolumes to:\n%s\n"+
+		"Current subvolumes are kept as snapshots tagged %s. Mounted subvolumes change on their next mount, e.g. after a reboot.",
+		len(members), strings.Join(members, "\n"), rollbackTag)
+	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+		err := RollbackGroup(defaultBtrfsPath, members, time.Now())
+		ui.refresh()
+		if err != nil {
+			return ui.showDialog("Roll Back Group", fmt.Sprintf("Error rolling back:\n%v", err))
+		}
+		return ui.showDialog("Roll Back Group", fmt.Sprintf("Rolled back %d subvolumes.\nReboot or remount them to use the restored state.", len(members)))
+	})
+}
+
+// toggleMark marks or unmarks the selected snapshot
+func (ui *UI) toggleMark(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	ui.snapshotsData.ToggleMark()
+	ui.snapshotsData.Render(v)
+	return nil
+}
+
+// markRange marks snapshots between the last toggled one and the selected one
+func (ui *UI) markRange(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	ui.snapshotsData.MarkRange()
+	ui.snapshotsData.Render(v)
+	return nil
+}
+
+// markOlder marks all snapshots older than the selected one
+func (ui *UI) markOlder(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	selectedTime, ok := SnapshotTime(ui.snapshotsData.GetSelected())
+	if !ok {
+		return nil
+	}
+	for _, snapshot := range ui.snapshotsData.items {
+		if ui.snapshotMetas[snapshot].pinned {
+			continue
+		}
+		if t, ok := SnapshotTime(snapshot); ok && t.Before(selectedTime) {
+			ui.snapshotsData.marked[snapshot] = true
+		}
+	}
+	ui.snapshotsData.Render(v)
+	return nil
+}
+
+// togglePin pins or unpins the selected snapshot
+func (ui *UI) togglePin(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	snapshot := ui.snapshotsData.GetSelected()
+	if snapshot == "" {
+		return nil
+	}
+	meta := ui.snapshotMetas[snapshot]
+	if err := SetPinned(fmt.Sprintf("%s/%s", defaultBtrfsPath, snapshot), !meta.pinned); err != nil {
+		return ui.showDialog("Pin Snapshot", fmt.Sprintf("Error pinning %s:\n%v", snapshot, err))
+	}
+	// Attributes do not change the generation, so the cached meta is updated here
+	meta.pinned = !meta.pinned
+	ui.snapshotMetas[snapshot] = meta
+	ui.snapshotsData.Render(v)
+	return nil
+}
+
+// clearMarks unmarks all snapshots
+func (ui *UI) clearMarks(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	ui.snapshotsData.ClearMarks()
+	ui.snapshotsData.Render(v)
+	return nil
+}
+
+// searchableData returns list data of the view if it supports search and filter
+func (ui *UI) searchableData(v *gocui.View) *ViewData {
+	switch v.Name() {
+	case viewSubvolumes:
+		return ui.subvolumesData
+	case viewSnapshots:
+		return ui.snapshotsData
+	}
+	return nil
+}
+
+// selectItem moves the cursor of a list view to index and updates dependent views
+func (ui *UI) selectItem(v *gocui.View, data *ViewData, index int) {
+	data.selected = index
+	data.Render(v)
+	if v.Name() == viewSubvolumes {
+		ui.UpdateViewContent()
+	} else {
+		ui.updateSnapshotInfo()
+	}
+}
+
+// search jumps to the first item containing the text while it is typed
+func (ui *UI) search(g *gocui.Gui, v *gocui.View) error {
+	if v == nil || ui.isDialogVisible() {
+		return nil
+	}
+	data := ui.searchableData(v)
+	if data == nil {
+		return nil
+	}
+
+	view := v
+	original := data.selected
+	change := func(query string) {
+		index := original
+		if query != "" {
+			index = data.Find(query, original, 1)
+		}
+		if index >= 0 && index < len(data.items) {
+			ui.selectItem(view, data, index)
+		}
+	}
+	submit := func(query string) error {
+		ui.searchQuery = query
+		return nil
+	}
+	cancel := func() {
+		change("")
+	}
+	return ui.showIncrementalInputDialog("Search", fmt.Sprintf("Type to jump to the first matching item.\nUse %s/%s for the next/previous match.", keyLabel("next-match"), keyLabel("prev-match")),
+		change, submit, cancel)
+}
+
+// nextMatch jumps to the next item matching the last search
+func (ui *UI) nextMatch(g *gocui.Gui, v *gocui.View) error {
+	return ui.jumpToMatch(v, 1)
+}
+
+// prevMatch jumps to the previous item matching the last search
+func (ui *UI) prevMatch(g *gocui.Gui, v *gocui.View) error {
+	return ui.jumpToMatch(v, -1)
+}
+
+// jumpToMatch moves the cursor to the nearest match of the last search in direction step
+func (ui *UI) jumpToMatch(v *gocui.View, step int) error {
+	if v == nil || ui.isDialogVisible() || ui.searchQuery == "" {
+		return nil
+	}
+	data := ui.searchableData(v)
+	if data == nil {
+		return nil
+	}
+	if index := data.Find(ui.searchQuery, data.selected+step, step); index >= 0 {
+		ui.selectItem(v, data, index)
+	}
+	return nil
+}
+
+// filterItems asks for a filter of the focused list, an empty filter shows all items
+func (ui *UI) filterItems(g *gocui.Gui, v *gocui.View) error {
+	if v == nil || ui.isDialogVisible() {
+		return nil
+	}
+	data := ui.searchableData(v)
+	if data == nil {
+		return nil
+	}
+
+	prompt := "Enter name substrings and/or a date range (from:YYYY-MM-DD to:YYYY-MM-DD).\nLeave empty to show all items."
+	if data.filter.Active() {
+		prompt = fmt.Sprintf("%s\nCurrent filter: %s", prompt, data.filter.Text)
+	}
+	return ui.showInputDialog("Filter", prompt, func(value string) error {
+		filter, err := ParseFilter(value)
+		if err != nil {
+			return ui.showDialog("Filter", fmt.Sprintf("Error in filter:\n%v", err))
+		}
+		data.SetFilter(filter)
 		ui.UpdateViewContent()
+		ui.updateHotkeys()
 		return nil
 	})
 }
@@ -367,35 +1140,180 @@ func (ui *UI) createSnapshot(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 
-	// Extract base subvolume name
-	parts := strings.Split(selectedSubvol, "/")
-	if len(parts) < 2 {
-		return nil
+	// Snapshots of nested subvolumes would be named and listed like those of their parent
+	if !IsTopSubvolume(selectedSubvol) {
+		return ui.showDialog("Create Snapshot", fmt.Sprintf("%s is nested in another subvolume.\n"+
+			"Only subvolumes directly below %s can be snapshotted.", selectedSubvol, subvolumePrefix))
 	}
-	subvolBase := strings.Split(parts[1], "-")[0]
-
-	// Create confirmation message
-	message := fmt.Sprintf("Are you sure you want to create snapshot for:\n%s?", selectedSubvol)
+	subvolBase := SubvolumeBase(selectedSubvol)
 
-	// Show confirmation dialog
-	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+	// The tag names the snapshot, the full text is kept as its description
+	message := fmt.Sprintf("Create snapshot of %s?\nOptional tag or description, e.g. before-kernel-6.10:", selectedSubvol)
+	return ui.showInputDialog("Create Snapshot", message, func(tag string) error {
 		// Create path for new snapshot
-		timestamp := time.Now().Format("20060102-150405")
-		snapshotName := fmt.Sprintf("%s/%s-%s", snapshotPrefix, subvolBase, timestamp)
+		snapshotName := fmt.Sprintf("%s/%s", snapshotPrefix, SnapshotName(subvolBase, time.Now(), tag))
 		sourcePath := fmt.Sprintf("%s/%s", defaultBtrfsPath, selectedSubvol)
 		destPath := fmt.Sprintf("%s/%s", defaultBtrfsPath, snapshotName)
 
 		// Create snapshot
 		if err := CreateSnapshot(sourcePath, destPath); err != nil {
-			return err
+			return ui.showDialog("Create Snapshot", fmt.Sprintf("Error creating %s:\n%v", snapshotName, err))
+		}
+		// A single snapshot belongs to no group, even if its source was restored from one
+		if err := SetSnapshotOrigin(destPath, selectedSubvol, ""); err != nil {
+			ui.refresh()
+			return ui.showDialog("Create Snapshot", fmt.Sprintf("Created %s, but its source was not saved:\n%v", snapshotName, err))
+		}
+		if tag != "" {
+			if err := SetDescription(destPath, tag); err != nil {
+				ui.refresh()
+				return ui.showDialog("Create Snapshot", fmt.Sprintf("Created %s, but its description was not saved:\n%v", snapshotName, err))
+			}
 		}
 
 		// Update display
-		ui.UpdateViewContent()
+		ui.refresh()
 		return nil
 	})
 }
 
+// snapshotAll snapshots every active subvolume with one timestamp and an optional tag
+func (ui *UI) snapshotAll(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	all, _ := splitSubvolumes(ui.subvolumes)
+	subvolumes := TopSubvolumes(all)
+	if len(subvolumes) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Snapshot %d subvolumes as one group?\n%s\nOptional tag or description:",
+		len(subvolumes), strings.Join(subvolumes, "\n"))
+	return ui.showInputDialog("Snapshot All", message, func(tag string) error {
+		created, err := SnapshotAll(defaultBtrfsPath, subvolumes, time.Now(), tag)
+		ui.refresh()
+		// The whole group is returned when only descriptions failed
+		if err != nil && len(created) < len(subvolumes) {
+			return ui.showDialog("Snapshot All", fmt.Sprintf("Error taking snapshots:\n%v", err))
+		}
+		message := fmt.Sprintf("Created %d snapshots:\n%s", len(created), strings.Join(created, "\n"))
+		if err != nil {
+			message += fmt.Sprintf("\n%v", err)
+		}
+		return ui.showDialog("Snapshot All", message)
+	})
+}
+
+// addDevice asks for a device path and adds it to the filesystem
+func (ui *UI) addDevice(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	return ui.showInputDialog("Add Device", "Enter path of the device to add (e.g. /dev/sdc):", func(device string) error {
+		if device == "" {
+			return nil
+		}
+		message := fmt.Sprintf("Are you sure you want to add device:\n%s?\nAll data on it will be lost.", device)
+		return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+			if err := AddDevice(device, defaultBtrfsPath); err != nil {
+				return ui.showDialog("Add Device", fmt.Sprintf("Error adding device:\n%v", err))
+			}
+			ui.updateDevices()
+			ui.updateDiskInfo()
+			return ui.showDialog("Add Device", fmt.Sprintf("Device %s added.\nRun a balance to spread existing data.", device))
+		})
+	})
+}
+
+// removeDevice removes the selected device from the filesystem
+func (ui *UI) removeDevice(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	device := ui.devicesData.GetSelected()
+	if device == "" {
+		return nil
+	}
+	message := fmt.Sprintf("Are you sure you want to remove device:\n%s?\nIts data will be relocated to other devices.", device)
+	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+		// Relocation may take a long time, so run it in the background
+		path := defaultBtrfsPath
+		state := ui.currentState()
+		state.removeStatus = fmt.Sprintf("removing %s", device)
+		ui.updateDevices()
+		go func() {
+			err := RemoveDevice(device, path)
+			ui.gui.Update(func(g *gocui.Gui) error {
+				state.removeStatus = fmt.Sprintf("%s removed", device)
+				if err != nil {
+					state.removeStatus = fmt.Sprintf("removing %s failed, see history %s", device, keyLabel("history"))
+				}
+				if path != defaultBtrfsPath {
+					return nil
+				}
+				ui.updateDevices()
+				ui.updateDiskInfo()
+				// Do not replace a dialog the user is working with, the status stays in the title
+				if err != nil && !ui.isDialogVisible() {
+					return ui.showDialog("Remove Device", fmt.Sprintf("Error removing device:\n%v", err))
+				}
+				return nil
+			})
+		}()
+		return ui.showDialog("Remove Device", fmt.Sprintf("Removing device %s in the background.\n"+
+			"Data is being relocated, progress is shown in the Devices title.", device))
+	})
+}
+
+// replaceDevice asks for a target device and starts replacing the selected device
+func (ui *UI) replaceDevice(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	source := ui.devicesData.GetSelected()
+	if source == "" {
+		return nil
+	}
+	prompt := fmt.Sprintf("Enter path of the device to replace %s with:", source)
+	return ui.showInputDialog("Replace Device", prompt, func(target string) error {
+		if target == "" {
+			return nil
+		}
+		message := fmt.Sprintf("Are you sure you want to replace device:\n%s -> %s?\nAll data on %s will be lost.", source, target, target)
+		return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+			if err := StartReplace(source, target, defaultBtrfsPath); err != nil {
+				return ui.showDialog("Replace Device", fmt.Sprintf("Error replacing device:\n%v", err))
+			}
+			ui.watchReplace()
+			return nil
+		})
+	})
+}
+
+// resetDeviceStats resets error counters of all devices
+func (ui *UI) resetDeviceStats(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
+	message := "Are you sure you want to reset error counters of all devices?"
+	return ui.showConfirmationDialog(message, func(g *gocui.Gui, v *gocui.View) error {
+		if err := ResetDeviceStats(defaultBtrfsPath); err != nil {
+			return ui.showDialog("Reset Error Counters", fmt.Sprintf("Error resetting device stats:\n%v", err))
+		}
+		ui.updateHealth()
+		return nil
+	})
+}
+
+// watchReplace polls replace status in the background while a replace is running
+func (ui *UI) watchReplace() {
+	ui.watchOperation("replace", replacePollInterval, func(path string) (bool, func(*filesystemState)) {
+		status, err := GetReplaceStatus(path)
+		return err != nil || !ReplaceRunning(status), func(state *filesystemState) { state.replaceStatus = status }
+	}, ui.updateDevices)
+}
+
 // updateHotkeys updates hotkey display based on current view
 func (ui *UI) updateHotkeys() {
 	hotkeyView, err := ui.gui.View(viewHotkeys)
@@ -404,137 +1322,111 @@ func (ui *UI) updateHotkeys() {
 	}
 	hotkeyView.Clear()
 
+	if ui.dialog != nil {
+		fmt.Fprint(hotkeyView, ui.dialog.hotkeys())
+		return
+	}
+	// The help overlay shows its own keys
 	if ui.isDialogVisible() {
-		dialogView, err := ui.gui.View(viewDialog)
-		if err != nil {
-			return
-		}
-		
-		// Check dialog type by title
-		if dialogView.Title == "GRUB Update" {
-			fmt.Fprint(hotkeyView, "Enter: Close")
-		} else {
-			fmt.Fprint(hotkeyView, "Enter: Execute | c: Cancel")
-		}
 		return
 	}
 
-	baseHotkeys := "q: Quit | ←/→: Switch view | ↑/↓: Navigate | g: Update GRUB | b: Btrfs balance"
-	if ui.currentView == viewSubvolumes {
-		fmt.Fprintf(hotkeyView, "%s | t: Create snapshot", baseHotkeys)
-	} else if ui.currentView == viewSnapshots {
-		fmt.Fprintf(hotkeyView, "%s | r: Remove snapshot", baseHotkeys)
-	} else {
-		fmt.Fprint(hotkeyView, baseHotkeys)
+	// The bar is generated from the active key bindings of the current view
+	hotkeys := ui.hotkeys(ui.currentView)
+	if data := ui.listData(ui.currentView); data != nil {
+		hotkeys += filterHotkey(data)
 	}
+	fmt.Fprint(hotkeyView, hotkeys)
 }
 
-// showDialog displays a dialog window with a message
-func (ui *UI) showDialog(message string) error {
-	maxX, maxY := ui.gui.Size()
-	width := 60
-	height := 10
-	x := maxX/2 - width/2
-	y := maxY/2 - height/2
-
-	v, err := ui.gui.SetView(viewDialog, x, y, x+width, y+height)
-	if err != nil && err != gocui.ErrUnknownView {
-		return err
+// filterHotkey describes the active filter of data for the hotkeys bar
+func filterHotkey(data *ViewData) string {
+	if !data.filter.Active() {
+		return ""
 	}
+	return fmt.Sprintf(" | Filtered by %q, %s then Enter to clear", data.filter.Text, keyLabel("filter"))
+}
 
-	v.Title = "GRUB Update"
-	v.Wrap = true
-	v.Clear()
-	fmt.Fprintln(v, message)
-	
-	// Add closing instruction
-	fmt.Fprintln(v, "\nPress Enter to close")
-
-	if _, err := ui.gui.SetCurrentView(viewDialog); err != nil {
-		return err
+// updateGrub updates GRUB configuration
+func (ui *UI) updateGrub(g *gocui.Gui, v *gocui.View) error {
+	output, err := ExecuteCommand("sudo","update-grub") //FIXME:
+	audit("grub", "update-grub", err)
+	if err != nil {
+		return ui.showDialog("GRUB Update", fmt.Sprintf("Error updating GRUB:\n%v", err))
 	}
+	return ui.showDialog("GRUB Update", fmt.Sprintf("GRUB successfully updated:\n%s", output))
+}
 
-	// Add handler for dialog closing
-	if err := ui.gui.SetKeybinding(viewDialog, gocui.KeyEnter, gocui.ModNone,
-		func(g *gocui.Gui, v *gocui.View) error {
-			return ui.closeDialog()
-		}); err != nil {
-		return err
+// showHistory focuses the history pane, reloading the audit trail first
+func (ui *UI) showHistory(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
 	}
-
-	ui.updateHotkeys()
-	return nil
+	ui.updateHistory()
+	return ui.focusView(viewHistory)
 }
 
-// showConfirmationDialog displays an action confirmation dialog
-func (ui *UI) showConfirmationDialog(message string, confirmAction func(*gocui.Gui, *gocui.View) error) error {
+// showHelp shows all key bindings in an overlay, closed with Esc, q, ? or Enter
+func (ui *UI) showHelp(g *gocui.Gui, v *gocui.View) error {
+	if ui.isDialogVisible() {
+		return nil
+	}
 	maxX, maxY := ui.gui.Size()
-	width := 60
-	height := 10
-	x := maxX/2 - width/2
-	y := maxY/2 - height/2
-
-	v, err := ui.gui.SetView(viewDialog, x, y, x+width, y+height)
+	help, err := ui.gui.SetView(viewHelp, 2, 1, maxX-3, maxY-2)
 	if err != nil && err != gocui.ErrUnknownView {
 		return err
 	}
-
-	v.Title = "Action Confirmation"
-	v.Wrap = true
-	v.Clear()
-	fmt.Fprintln(v, message)
-
-	if _, err := ui.gui.SetCurrentView(viewDialog); err != nil {
+	help.Title = "Help"
+	help.Frame = true
+	help.Clear()
+	help.SetOrigin(0, 0)
+	fmt.Fprint(help, helpText())
+	if _, err := ui.gui.SetCurrentView(viewHelp); err != nil {
 		return err
 	}
 
-	// Confirmation handler
-	if err := ui.gui.SetKeybinding(viewDialog, gocui.KeyEnter, gocui.ModNone,
-		func(g *gocui.Gui, v *gocui.View) error {
-			ui.closeDialog()
-			return confirmAction(g, v)
-		}); err != nil {
-		return err
+	closeHelp := func(g *gocui.Gui, v *gocui.View) error {
+		ui.gui.DeleteKeybindings(viewHelp)
+		if err := ui.gui.DeleteView(viewHelp); err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		if _, err := ui.gui.SetCurrentView(ui.currentView); err != nil {
+			return err
+		}
+		ui.updateHotkeys()
+		return nil
 	}
-
-	// Cancel handler
-	if err := ui.gui.SetKeybinding(viewDialog, 'c', gocui.ModNone,
-		func(g *gocui.Gui, v *gocui.View) error {
-			return ui.closeDialog()
-		}); err != nil {
-		return err
+	scroll := func(delta int) func(g *gocui.Gui, v *gocui.View) error {
+		return func(g *gocui.Gui, v *gocui.View) error {
+			ox, oy := v.Origin()
+			if oy+delta >= 0 && oy+delta < len(v.BufferLines()) {
+				v.SetOrigin(ox, oy+delta)
+			}
+			return nil
+		}
 	}
-
-	ui.updateHotkeys()
-	return nil
-}
-
-// closeDialog closes the dialog window
-func (ui *UI) closeDialog() error {
-	// Check if dialog window exists before deletion
-	if v, _ := ui.gui.View(viewDialog); v != nil {
-		// Remove Enter key handler
-		ui.gui.DeleteKeybinding(viewDialog, gocui.KeyEnter, gocui.ModNone)
-		
-		if err := ui.gui.DeleteView(viewDialog); err != nil && err != gocui.ErrUnknownView {
+	for _, k := range []interface{}{gocui.KeyEsc, gocui.KeyEnter, 'q', '?'} {
+		if err := ui.gui.SetKeybinding(viewHelp, k, gocui.ModNone, closeHelp); err != nil {
 			return err
 		}
 	}
-	
-	if _, err := ui.gui.SetCurrentView(ui.currentView); err != nil {
-		return err
+	for _, k := range []interface{}{gocui.KeyArrowUp, 'k', gocui.MouseWheelUp} {
+		if err := ui.gui.SetKeybinding(viewHelp, k, gocui.ModNone, scroll(-1)); err != nil {
+			return err
+		}
+	}
+	for _, k := range []interface{}{gocui.KeyArrowDown, 'j', gocui.MouseWheelDown} {
+		if err := ui.gui.SetKeybinding(viewHelp, k, gocui.ModNone, scroll(1)); err != nil {
+			return err
+		}
 	}
-	ui.updateHotkeys()
-	return nil
-}
 
-// updateGrub updates GRUB configuration
-func (ui *UI) updateGrub(g *gocui.Gui, v *gocui.View) error {
-	output, err := ExecuteCommand("sudo","update-grub") //FIXME:
-	if err != nil {
-		return ui.showDialog(fmt.Sprintf("Error updating GRUB:\n%v", err))
+	hotkeyView, err := ui.gui.View(viewHotkeys)
+	if err == nil {
+		hotkeyView.Clear()
+		fmt.Fprint(hotkeyView, "↑/↓: Scroll | Esc: Close")
 	}
-	return ui.showDialog(fmt.Sprintf("GRUB successfully updated:\n%s", output))
+	return nil
 }
 
 func quit(g *gocui.Gui, v *gocui.View) error {
@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lowUnallocatedRatio is the share of device size below which unallocated space is reported as low
+const lowUnallocatedRatio = 0.10
+
+// BlockGroupUsage describes allocation of one block group type (Data, Metadata, System)
+type BlockGroupUsage struct {
+	Type    string
+	Profile string
+	Size    uint64
+	Used    uint64
+}
+
+// FilesystemUsage holds parsed output of 'btrfs filesystem usage -b'
+type FilesystemUsage struct {
+	DeviceSize        uint64
+	DeviceAllocated   uint64
+	DeviceUnallocated uint64
+	Used              uint64
+	FreeEstimated     uint64
+	FreeMin           uint64
+	DataRatio         float64
+	MetadataRatio     float64
+	BlockGroups       []BlockGroupUsage
+}
+
+// GetFilesystemUsage executes 'btrfs filesystem usage -b' command and returns parsed results
+func GetFilesystemUsage(path string) (*FilesystemUsage, error) {
+	output, err := runner.Output("btrfs", "filesystem", "usage", "-b", path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFilesystemUsage(string(output))
+}
+
+// ParseFilesystemUsage parses output of 'btrfs filesystem usage -b'
+func ParseFilesystemUsage(output string) (*FilesystemUsage, error) {
+	usage := &FilesystemUsage{}
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		// Block group header, e.g. "Data,single: Size:1073741824, Used:0 (0.00%)"
+		if !strings.HasPrefix(line, " ") && strings.Contains(line, ": Size:") {
+			group, err := parseBlockGroupHeader(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			usage.BlockGroups = append(usage.BlockGroups, group)
+			continue
+		}
+
+		// Overall section, e.g. "Device size:   107374182400"
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Device size":
+			usage.DeviceSize, _ = strconv.ParseUint(fields[0], 10, 64)
+		case "Device allocated":
+			usage.DeviceAllocated, _ = strconv.ParseUint(fields[0], 10, 64)
+		case "Device unallocated":
+			usage.DeviceUnallocated, _ = strconv.ParseUint(fields[0], 10, 64)
+		case "Used":
+			usage.Used, _ = strconv.ParseUint(fields[0], 10, 64)
+		case "Free (estimated)":
+			usage.FreeEstimated, _ = strconv.ParseUint(fields[0], 10, 64)
+			// Minimum estimate is printed as "(min: N)"
+			if len(fields) >= 3 && fields[1] == "(min:" {
+				usage.FreeMin, _ = strconv.ParseUint(strings.TrimSuffix(fields[2], ")"), 10, 64)
+			}
+		case "Data ratio":
+			usage.DataRatio, _ = strconv.ParseFloat(fields[0], 64)
+		case "Metadata ratio":
+			usage.MetadataRatio, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+
+	if usage.DeviceSize == 0 {
+		return nil, fmt.Errorf("unexpected btrfs filesystem usage output")
+	}
+	return usage, nil
+}
+
+// parseBlockGroupHeader parses a block group header line of 'btrfs filesystem usage -b'
+func parseBlockGroupHeader(line string) (BlockGroupUsage, error) {
+	var group BlockGroupUsage
+
+	name, rest, _ := strings.Cut(line, ": ")
+	group.Type, group.Profile, _ = strings.Cut(name, ",")
+
+	for _, field := range strings.Fields(rest) {
+		key, value, found := strings.Cut(strings.TrimSuffix(field, ","), ":")
+		if !found {
+			continue
+		}
+		number, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return group, fmt.Errorf("failed to parse block group %q: %v", name, err)
+		}
+		switch key {
+		case "Size":
+			group.Size = number
+		case "Used":
+			group.Used = number
+		}
+	}
+	return group, nil
+}
+
+// LowUnallocated reports whether unallocated space is too low for new chunk allocations
+func (u *FilesystemUsage) LowUnallocated() bool {
+	return float64(u.DeviceUnallocated) < float64(u.DeviceSize)*lowUnallocatedRatio
+}
+
+// Summary returns usage formatted as compact human-readable lines
+func (u *FilesystemUsage) Summary() []string {
+	lines := []string{
+		fmt.Sprintf("Size: %s  Allocated: %s (%s)  Unallocated: %s (%s)",
+			formatBytes(u.DeviceSize),
+			formatBytes(u.DeviceAllocated), formatPercent(u.DeviceAllocated, u.DeviceSize),
+			formatBytes(u.DeviceUnallocated), formatPercent(u.DeviceUnallocated, u.DeviceSize)),
+		fmt.Sprintf("Used: %s  Free: %s (min: %s)  Data ratio: %.2f  Metadata ratio: %.2f",
+			formatBytes(u.Used), formatBytes(u.FreeEstimated), formatBytes(u.FreeMin),
+			u.DataRatio, u.MetadataRatio),
+	}
+
+	groups := make([]string, 0, len(u.BlockGroups))
+	for _, group := range u.BlockGroups {
+		groups = append(groups, fmt.Sprintf("%s,%s: %s/%s (%s)",
+			group.Type, group.Profile, formatBytes(group.Used), formatBytes(group.Size),
+			formatPercent(group.Used, group.Size)))
+	}
+	return append(lines, strings.Join(groups, "  "))
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// formatPercent formats part as a percentage of total
+func formatPercent(part, total uint64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)*100/float64(total))
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// btrfsSuperMagic is the statfs filesystem type of Btrfs
+const btrfsSuperMagic = 0x9123683E
+
+// Subvolume object IDs from the Btrfs on-disk format
+const (
+	topLevelSubvolumeID = 5
+	// firstFreeObjectID is the inode number of every subvolume root directory
+	firstFreeObjectID = 256
+)
+
+// CheckRoot returns an error if the process is not running as root
+func CheckRoot() error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("butterfs needs root privileges to manage Btrfs subvolumes\n" +
+			"Run it with sudo, e.g.: sudo butterfs /mnt/defvol")
+	}
+	return nil
+}
+
+// ValidateTopLevel checks that path is the top-level subvolume of a Btrfs filesystem
+// and returns an actionable error otherwise
+func ValidateTopLevel(path string) error {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return fmt.Errorf("cannot access %s: %v", path, err)
+	}
+	if uint32(fs.Type) != btrfsSuperMagic {
+		return fmt.Errorf("%s is not on a Btrfs filesystem (filesystem type 0x%x)\n"+
+			"Pass the mount point of a Btrfs filesystem, its device or its UUID", path, uint32(fs.Type))
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return fmt.Errorf("cannot access %s: %v", path, err)
+	}
+	if stat.Ino != firstFreeObjectID {
+		return fmt.Errorf("%s is a directory, not the root of a Btrfs subvolume\n"+
+			"Pass the mount point of the top-level subvolume, e.g. /mnt/defvol", path)
+	}
+
+	id, err := GetSubvolumeID(path)
+	if err != nil {
+		return fmt.Errorf("cannot determine subvolume of %s: %v", path, err)
+	}
+	if id != topLevelSubvolumeID {
+		return fmt.Errorf("%s is subvolume %d, not the top-level subvolume\n"+
+			"Mount the top-level subvolume with subvolid=5, e.g.:\n"+
+			"  sudo mount -o subvolid=5 <device> /mnt/defvol\n"+
+			"or pass the device or UUID instead of the path", path, id)
+	}
+	return nil
+}
+
+// GetSubvolumeID executes 'btrfs inspect-internal rootid' command and returns the ID
+// of the subvolume containing path
+func GetSubvolumeID(path string) (uint64, error) {
+	output, err := runner.Output("btrfs", "inspect-internal", "rootid", path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+}
@@ -11,6 +11,17 @@ import (
 type ViewData struct {
 	items    []string
 	selected int
+	// marked holds multi-selected items by identity, anchor is the last toggled index
+	marked map[string]bool
+	anchor int
+	// format optionally renders an item as a line of the given width
+	format func(item string, width int) string
+	// all holds every item, items only those passing filter
+	all    []string
+	filter Filter
+	// header optionally renders a fixed first line, top is then the first item shown below it
+	header func(width int) string
+	top    int
 }
 
 // NewViewData creates a new instance of ViewData
@@ -18,12 +29,55 @@ func NewViewData() *ViewData {
 	return &ViewData{
 		items:    make([]string, 0),
 		selected: 0,
+		marked:   make(map[string]bool),
 	}
 }
 
-// SetItems sets the list of items to display
+// SetItems sets the list of items to display, keeping the selected item
+// selected if it is still present and its position otherwise
 func (vd *ViewData) SetItems(items []string) {
+	vd.all = items
+
+	// Drop marks of items that no longer exist
+	present := make(map[string]bool, len(items))
+	for _, item := range items {
+		present[item] = true
+	}
+	for item := range vd.marked {
+		if !present[item] {
+			delete(vd.marked, item)
+		}
+	}
+
+	vd.applyFilter()
+}
+
+// SetFilter shows only items passing the filter
+func (vd *ViewData) SetFilter(filter Filter) {
+	vd.filter = filter
+	vd.applyFilter()
+}
+
+// applyFilter updates the displayed items from all items and the filter
+func (vd *ViewData) applyFilter() {
+	items := vd.all
+	if vd.filter.Active() {
+		items = make([]string, 0, len(vd.all))
+		for _, item := range vd.all {
+			if vd.filter.Match(item) {
+				items = append(items, item)
+			}
+		}
+	}
+
+	selected := vd.GetSelected()
 	vd.items = items
+	for i, item := range items {
+		if item == selected {
+			vd.selected = i
+			break
+		}
+	}
 	if vd.selected >= len(items) {
 		vd.selected = len(items) - 1
 	}
@@ -32,6 +86,68 @@ func (vd *ViewData) SetItems(items []string) {
 	}
 }
 
+// Find returns the index of the next item containing query (case-insensitive),
+// starting at index from and moving by step (1 or -1) with wrap-around, or -1 if none matches
+func (vd *ViewData) Find(query string, from int, step int) int {
+	query = strings.ToLower(query)
+	count := len(vd.items)
+	for n := 0; n < count; n++ {
+		i := ((from+n*step)%count + count) % count
+		if strings.Contains(strings.ToLower(vd.items[i]), query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ToggleMark marks or unmarks the selected item
+func (vd *ViewData) ToggleMark() {
+	item := vd.GetSelected()
+	if item == "" {
+		return
+	}
+	if vd.marked[item] {
+		delete(vd.marked, item)
+	} else {
+		vd.marked[item] = true
+	}
+	vd.anchor = vd.selected
+}
+
+// MarkRange marks all items between the anchor and the selected item
+func (vd *ViewData) MarkRange() {
+	if len(vd.items) == 0 {
+		return
+	}
+	from, to := vd.anchor, vd.selected
+	if from > to {
+		from, to = to, from
+	}
+	if to >= len(vd.items) {
+		to = len(vd.items) - 1
+	}
+	for i := from; i <= to; i++ {
+		vd.marked[vd.items[i]] = true
+	}
+	vd.anchor = vd.selected
+}
+
+// ClearMarks unmarks all items
+func (vd *ViewData) ClearMarks() {
+	vd.marked = make(map[string]bool)
+}
+
+// GetMarked returns marked items in display order
+func (vd *ViewData) GetMarked() []string {
+	var marked []string
+	for _, item := range vd.items {
+		if vd.marked[item] {
+			marked = append(marked, item)
+		}
+	}
+	return marked
+}
+
 // MoveUp moves the cursor up in the list
 func (vd *ViewData) MoveUp() {
 	if vd.selected > 0 {
@@ -46,6 +162,29 @@ func (vd *ViewData) MoveDown() {
 	}
 }
 
+// MoveBy moves the cursor by delta items, stopping at the first and last item
+func (vd *ViewData) MoveBy(delta int) {
+	vd.selected = min(max(vd.selected+delta, 0), max(len(vd.items)-1, 0))
+}
+
+// IndexAt returns the index of the item shown on a row of the view, or -1 if there is none
+func (vd *ViewData) IndexAt(v *gocui.View, row int) int {
+	index := row
+	if vd.header != nil {
+		index = vd.top + row - 1
+		if row == 0 {
+			return -1
+		}
+	} else {
+		_, oy := v.Origin()
+		index = oy + row
+	}
+	if index < 0 || index >= len(vd.items) {
+		return -1
+	}
+	return index
+}
+
 // GetSelected returns the selected item
 func (vd *ViewData) GetSelected() string {
 	if len(vd.items) == 0 {
@@ -56,6 +195,10 @@ func (vd *ViewData) GetSelected() string {
 
 // Render displays content in the view
 func (vd *ViewData) Render(v *gocui.View) {
+	if vd.header != nil {
+		vd.renderWithHeader(v)
+		return
+	}
 	v.Clear()
 	
 	_, viewHeight := v.Size()
@@ -70,12 +213,9 @@ func (vd *ViewData) Render(v *gocui.View) {
 		v.SetOrigin(ox, vd.selected-viewHeight+1)
 	}
 	
-	for i, item := range vd.items {
-		if i == vd.selected {
-			fmt.Fprintf(v, ">%s", item) // Use indentation for consistency
-		} else {
-			fmt.Fprintf(v, " %s", item)
-		}
+	width, _ := v.Size()
+	for i := range vd.items {
+		fmt.Fprint(v, vd.line(i, width))
 		if i < len(vd.items)-1 {
 			fmt.Fprintln(v) // Add line break between items
 		}
@@ -85,6 +225,49 @@ func (vd *ViewData) Render(v *gocui.View) {
 	v.SetCursor(0, vd.selected)
 }
 
+// renderWithHeader displays the header above the items, scrolling only the items
+func (vd *ViewData) renderWithHeader(v *gocui.View) {
+	v.Clear()
+	v.SetOrigin(0, 0)
+
+	width, height := v.Size()
+	rows := height - 1
+	if vd.selected < vd.top {
+		vd.top = vd.selected
+	} else if rows > 0 && vd.selected >= vd.top+rows {
+		vd.top = vd.selected - rows + 1
+	}
+	// Keep the view filled after items were removed
+	if vd.top > len(vd.items)-rows {
+		vd.top = len(vd.items) - rows
+	}
+	if vd.top < 0 {
+		vd.top = 0
+	}
+
+	fmt.Fprint(v, "  "+vd.header(width-2))
+	for i := vd.top; i < len(vd.items) && i < vd.top+rows; i++ {
+		fmt.Fprint(v, "\n"+vd.line(i, width))
+	}
+	v.SetCursor(0, vd.selected-vd.top+1)
+}
+
+// line renders item i with the cursor and mark columns
+func (vd *ViewData) line(i int, width int) string {
+	item := vd.items[i]
+	mark := " "
+	if vd.marked[item] {
+		mark = "*"
+	}
+	if vd.format != nil {
+		item = vd.format(item, width-2)
+	}
+	if i == vd.selected {
+		return fmt.Sprintf(">%s%s", mark, item) // Use indentation for consistency
+	}
+	return fmt.Sprintf(" %s%s", mark, item)
+}
+
 // updateSnapshotInfo updates information about selected snapshot
 func (ui *UI) updateSnapshotInfo() {
 	// Clear information if snapshots list is not selected
@@ -103,14 +286,8 @@ func (ui *UI) updateSnapshotInfo() {
 	}
 	infoView.Clear()
 
-	// Get list of snapshots
-	_, snapshots, err := GetBtrfsSubvolumes(defaultBtrfsPath)
-	if err != nil {
-		fmt.Fprintf(infoView, "Error getting snapshots: %v", err)
-		return
-	}
-
-	if len(snapshots) == 0 {
+	if ui.subvolumesErr != nil {
+		fmt.Fprintf(infoView, "Error getting snapshots: %v", ui.subvolumesErr)
 		return
 	}
 
@@ -118,83 +295,319 @@ func (ui *UI) updateSnapshotInfo() {
 	if len(ui.snapshotsData.items) > 0 {
 		selectedSnapshot := ui.snapshotsData.items[ui.snapshotsData.selected]
 		fullPath := fmt.Sprintf("%s/%s", defaultBtrfsPath, selectedSnapshot)
-		
-		info, err := GetBtrfsSnapshotInfo(fullPath)
+		subvolume, found := ui.findSubvolume(selectedSnapshot)
+		if !found {
+			return
+		}
+
+		info, err := ui.snapshotInfo(fullPath, subvolume.Gen)
 		if err != nil {
 			fmt.Fprintf(infoView, "Error getting snapshot info: %v", err)
-		} else {
-			fmt.Fprintf(infoView, "Snapshot information:\n%s", info)
+			return
 		}
+		fmt.Fprintf(infoView, "Snapshot information:\n%s", info)
+
+		// Quota groups give exact sizes, otherwise fall back to the sampling estimate
+		if ui.qgroups != nil {
+			usage := ui.snapshotUsage(selectedSnapshot)
+			fmt.Fprintf(infoView, "\n\tReferenced: \t\t%s\n\tExclusive: \t\t%s",
+				formatBytes(usage.Referenced), formatBytes(usage.Exclusive))
+			return
+		}
+		fmt.Fprintf(infoView, "\n\tExclusive (est.): \t%s", ui.formatEstimate(fullPath, subvolume.Gen))
 	}
 }
 
-// UpdateViewContent updates view content with data from btrfs
-func (ui *UI) UpdateViewContent() {
-	subvolumes, snapshots, err := GetBtrfsSubvolumes(defaultBtrfsPath)
+// findSubvolume looks up a subvolume by path in the cached listing
+func (ui *UI) findSubvolume(path string) (Subvolume, bool) {
+	subvolume, found := ui.subvolumeByPath[path]
+	return subvolume, found
+}
+
+// snapshotInfo returns subvolume information, fetching it only once per generation
+func (ui *UI) snapshotInfo(path string, gen uint64) (string, error) {
+	if entry, found := ui.snapshotInfos[path]; found && entry.gen == gen {
+		return entry.info, nil
+	}
+	info, err := GetBtrfsSnapshotInfo(path)
 	if err != nil {
+		return "", err
+	}
+	ui.snapshotInfos[path] = snapshotInfoEntry{gen: gen, info: info}
+	return info, nil
+}
+
+// formatEstimate returns the sampled exclusive size of a subvolume, starting the estimate if needed
+func (ui *UI) formatEstimate(path string, gen uint64) string {
+	entry := ui.estimates.Get(path, gen, func() {
+		ui.gui.Update(func(g *gocui.Gui) error {
+			// Show the new size in the table as well
+			if snapView, err := g.View(viewSnapshots); err == nil {
+				ui.snapshotsData.Render(snapView)
+			}
+			ui.updateSnapshotInfo()
+			return nil
+		})
+	})
+	switch {
+	case !entry.done:
+		return "estimating..."
+	case entry.err != nil:
+		return fmt.Sprintf("error: %v", entry.err)
+	default:
+		return fmt.Sprintf("~%s (sampled %d of %d files)",
+			formatBytes(entry.estimate.Exclusive), entry.estimate.SampledFiles, entry.estimate.TotalFiles)
+	}
+}
+
+// refresh reloads subvolumes, quota groups and disk usage of the current filesystem
+// and redraws the views. Navigation only redraws from the cached data.
+func (ui *UI) refresh() {
+	ui.subvolumes, ui.subvolumesErr = ListSubvolumes(defaultBtrfsPath)
+	ui.subvolumeByPath = make(map[string]Subvolume, len(ui.subvolumes))
+	// Attributes are read again only for new or changed snapshots
+	metas := make(map[string]snapshotMeta)
+	for _, subvolume := range ui.subvolumes {
+		ui.subvolumeByPath[subvolume.Path] = subvolume
+		if strings.HasPrefix(subvolume.Path, snapshotPrefix+"/") {
+			meta, found := ui.snapshotMetas[subvolume.Path]
+			if !found || meta.id != subvolume.ID || meta.gen != subvolume.Gen {
+				meta = loadSnapshotMeta(fmt.Sprintf("%s/%s", defaultBtrfsPath, subvolume.Path))
+				meta.id, meta.gen = subvolume.ID, subvolume.Gen
+			}
+			metas[subvolume.Path] = meta
+		}
+	}
+	ui.snapshotMetas = metas
+	ui.updateQgroups()
+	ui.updateDiskInfo()
+	ui.UpdateViewContent()
+}
+
+// UpdateViewContent updates view content from the cached subvolume listing
+func (ui *UI) UpdateViewContent() {
+	if ui.subvolumesErr != nil {
 		// In case of error, show it in the view
 		subvolView, _ := ui.gui.View(viewSubvolumes)
 		if subvolView != nil {
 			subvolView.Clear()
-			fmt.Fprintf(subvolView, "Error: %v", err)
+			fmt.Fprintf(subvolView, "Error: %v", ui.subvolumesErr)
 		}
 		return
 	}
+	subvolumes, snapshots := splitSubvolumes(ui.subvolumes)
 
 	// Update subvolumes data
 	ui.subvolumesData.SetItems(subvolumes)
 	if subvolView, err := ui.gui.View(viewSubvolumes); err == nil {
+		subvolView.Title = filterTitle("Subvolumes", ui.subvolumesData)
 		ui.subvolumesData.Render(subvolView)
 	}
 
 	// Update snapshots data
 	snapView, err := ui.gui.View(viewSnapshots)
 	if err == nil {
-		selectedSubvol := ui.subvolumesData.selected
-		if selectedSubvol >= 0 && selectedSubvol < len(subvolumes) {
-			// Extract subvolume name (part after "/" and before "-")
-			subvolName := subvolumes[selectedSubvol]
-			parts := strings.Split(subvolName, "/")
-			if len(parts) > 1 {
-				subvolBase := strings.Split(parts[1], "-")[0]
-				
-				// Filter snapshots for selected subvolume
-				filteredSnapshots := make([]string, 0)
-				for _, snap := range snapshots {
-					snapParts := strings.Split(snap, "/")
-					if len(snapParts) > 1 {
-						snapBase := strings.Split(snapParts[1], "-")[0]
-						if snapBase == subvolBase {
-							filteredSnapshots = append(filteredSnapshots, snap)
-						}
-					}
+		// Show the snapshots sharing the base name of the selected subvolume
+		filteredSnapshots := make([]string, 0)
+		if subvolBase := SubvolumeBase(ui.subvolumesData.GetSelected()); subvolBase != "" {
+			for _, snap := range snapshots {
+				if SubvolumeBase(snap) == subvolBase {
+					filteredSnapshots = append(filteredSnapshots, snap)
 				}
-				
-				// Save current cursor position
-				currentSelection := ui.snapshotsData.selected
-				
-				// Update snapshots data
-				ui.snapshotsData.SetItems(filteredSnapshots)
-				
-				// Restore cursor position if valid
-				if currentSelection >= 0 && currentSelection < len(filteredSnapshots) {
-					ui.snapshotsData.selected = currentSelection
-				}
-				
-				ui.snapshotsData.Render(snapView)
 			}
+			ui.sortSnapshots(filteredSnapshots)
 		}
-	}
-	diskView, err := ui.gui.View(viewDiskInfo)
-	if err == nil {
-		diskInfo, err := GetDiskInfo(defaultBtrfsPath)
-		if err != nil {
-			fmt.Fprintf(diskView, "Error getting disk info: %v", err)
-		} else {
-			fmt.Fprintln(diskView, diskInfo)
+
+		// Update snapshots data
+		ui.snapshotsData.SetItems(filteredSnapshots)
+		ui.snapshotsData.Render(snapView)
+
+		title := "Snapshots"
+		if ui.sortKey != sortListing || ui.sortReverse {
+			title = fmt.Sprintf("Snapshots (by %s)", sortKeyNames[ui.sortKey])
+			if ui.sortReverse {
+				title = fmt.Sprintf("Snapshots (by %s, reversed)", sortKeyNames[ui.sortKey])
+			}
 		}
+		snapView.Title = filterTitle(title, ui.snapshotsData)
 	}
 
 	// Update selected snapshot information
 	ui.updateSnapshotInfo()
 }
+
+// filterTitle appends the active filter of data to a view title
+func filterTitle(title string, data *ViewData) string {
+	if !data.filter.Active() {
+		return title
+	}
+	return fmt.Sprintf("%s [filter: %s]", title, data.filter.Text)
+}
+
+// updateDiskInfo updates the disk info view with btrfs filesystem usage
+func (ui *UI) updateDiskInfo() {
+	diskView, err := ui.gui.View(viewDiskInfo)
+	if err != nil {
+		return
+	}
+	diskView.Clear()
+
+	usage, err := GetFilesystemUsage(defaultBtrfsPath)
+	if err != nil {
+		fmt.Fprintf(diskView, "Error getting disk info: %v", err)
+		return
+	}
+
+	lines := usage.Summary()
+	if usage.LowUnallocated() {
+		// Highlight the allocation line when new chunks may fail to allocate
+		lines[0] = colorize(theme.Warning, lines[0]+"  LOW UNALLOCATED SPACE")
+	}
+	state := ui.currentState()
+	if state.balanceStatus != "" {
+		lines[2] = fmt.Sprintf("%s  Balance: %s", lines[2], state.balanceStatus)
+	}
+	if state.pendingCleanup > 0 {
+		lines[1] = fmt.Sprintf("%s  Pending cleanup: %d subvolume(s)", lines[1], state.pendingCleanup)
+	}
+	fmt.Fprint(diskView, strings.Join(lines, "\n"))
+}
+
+// updateQgroups refreshes quota group usage of all cached subvolumes, if quotas are enabled
+func (ui *UI) updateQgroups() {
+	ui.qgroups = nil
+	ui.subvolumeIDs = nil
+
+	if ui.subvolumesErr != nil {
+		return
+	}
+	qgroups, err := GetQgroups(defaultBtrfsPath)
+	if err != nil {
+		return
+	}
+	ui.qgroups = qgroups
+	ui.subvolumeIDs = make(map[string]uint64, len(ui.subvolumes))
+	for _, subvolume := range ui.subvolumes {
+		ui.subvolumeIDs[subvolume.Path] = subvolume.ID
+	}
+}
+
+// snapshotUsage returns quota group usage of the snapshot with the given path
+func (ui *UI) snapshotUsage(snapshot string) QgroupUsage {
+	return ui.qgroups[ui.subvolumeIDs[snapshot]]
+}
+
+// fitWidth pads or truncates text to exactly width characters
+func fitWidth(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) > width {
+		if width == 1 {
+			return "~"
+		}
+		return string(runes[:width-1]) + "~"
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// updateDevices updates the devices view with member devices of the filesystem
+func (ui *UI) updateDevices() {
+	devView, err := ui.gui.View(viewDevices)
+	if err != nil {
+		return
+	}
+
+	devView.Title = "Devices"
+	state := ui.currentState()
+	if state.replaceStatus != "" {
+		devView.Title = fmt.Sprintf("Devices (replace: %s)", state.replaceStatus)
+	} else if state.removeStatus != "" {
+		devView.Title = fmt.Sprintf("Devices (%s)", state.removeStatus)
+	}
+
+	devices, err := GetDevices(defaultBtrfsPath)
+	if err != nil {
+		devView.Clear()
+		fmt.Fprintf(devView, "Error getting devices: %v", err)
+		return
+	}
+
+	ui.devices = make(map[string]Device, len(devices))
+	paths := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ui.devices[device.Path] = device
+		paths = append(paths, device.Path)
+	}
+	ui.devicesData.SetItems(paths)
+	ui.devicesData.Render(devView)
+
+	ui.updateHealth()
+}
+
+// updateHealth updates the health view with device error counters
+func (ui *UI) updateHealth() {
+	healthView, err := ui.gui.View(viewHealth)
+	if err != nil {
+		return
+	}
+
+	stats, err := GetDeviceStats(defaultBtrfsPath)
+	if err != nil {
+		healthView.Clear()
+		fmt.Fprintf(healthView, "Error getting device stats: %v", err)
+		return
+	}
+
+	ui.deviceStats = make(map[string]DeviceStats, len(stats))
+	devices := make([]string, 0, len(stats))
+	for _, s := range stats {
+		ui.deviceStats[s.Device] = s
+		devices = append(devices, s.Device)
+	}
+	ui.healthData.SetItems(devices)
+	ui.healthData.Render(healthView)
+}
+
+// updateHistory updates the history view with the latest audit trail entries
+func (ui *UI) updateHistory() {
+	historyView, err := ui.gui.View(viewHistory)
+	if err != nil {
+		return
+	}
+
+	entries, err := AuditHistory()
+	if err != nil {
+		ui.historyData.SetItems(nil)
+		historyView.Clear()
+		fmt.Fprintf(historyView, "Error reading history: %v", err)
+		return
+	}
+	if len(entries) == 0 {
+		ui.historyData.SetItems(nil)
+		historyView.Clear()
+		fmt.Fprint(historyView, "No operations recorded yet.")
+		return
+	}
+	ui.historyData.SetItems(entries)
+	ui.historyData.Render(historyView)
+}
+
+// formatHealth renders error counters of a device, in red if any of them is non-zero
+func (ui *UI) formatHealth(device string, width int) string {
+	s := ui.deviceStats[device]
+	columns := fmt.Sprintf(" %d/%d/%d/%d/%d", s.WriteErrs, s.ReadErrs, s.FlushErrs, s.CorruptionErrs, s.GenerationErrs)
+	line := fitWidth(device, width-len(columns)) + columns
+	if s.Total() > 0 {
+		return colorize(theme.Warning, line)
+	}
+	return line
+}
+
+// formatDevice renders a device with its ID, size and used space
+func (ui *UI) formatDevice(path string, width int) string {
+	device := ui.devices[path]
+	columns := fmt.Sprintf(" %3d %9s %9s", device.ID, formatBytes(device.Size), formatBytes(device.Used))
+	return fitWidth(path, width-len(columns)) + columns
+}
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// changeDebounce is how long to wait for further changes before reporting them
+const changeDebounce = 500 * time.Millisecond
+
+// changePollInterval is how often subvolumes are listed when inotify is not available
+const changePollInterval = 10 * time.Second
+
+// maxChangePollInterval limits the backoff of polling after failed listings
+const maxChangePollInterval = 5 * time.Minute
+
+// inotifyMask selects directory entry changes, which include subvolume creation and deletion
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// WatchSubvolumes calls changed whenever subvolumes of the filesystem at path are
+// created, deleted or renamed. It watches the prefix directories with inotify and
+// falls back to polling subvolume listings, which never returns.
+func WatchSubvolumes(path string, changed func()) error {
+	if err := watchInotify(path, changed); err == nil {
+		return nil
+	}
+	return pollSubvolumes(path, changed)
+}
+
+// watchInotify reports changes of entries in the subvolume and snapshot prefix directories
+func watchInotify(path string, changed func()) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to initialize inotify: %v", err)
+	}
+	defer unix.Close(fd)
+
+	watched := 0
+	for _, prefix := range []string{subvolumePrefix, snapshotPrefix} {
+		if _, err := unix.InotifyAddWatch(fd, filepath.Join(path, prefix), inotifyMask); err == nil {
+			watched++
+		}
+	}
+	if watched == 0 {
+		return fmt.Errorf("no prefix directory to watch in %s", path)
+	}
+
+	buf := make([]byte, 4096)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return fmt.Errorf("failed to wait for inotify events: %v", err)
+		}
+		// Coalesce bursts of events, e.g. from deleting several snapshots
+		drainInotify(fd, buf)
+		time.Sleep(changeDebounce)
+		drainInotify(fd, buf)
+		changed()
+	}
+}
+
+// drainInotify discards all pending inotify events
+func drainInotify(fd int, buf []byte) {
+	for {
+		if n, err := unix.Read(fd, buf); err != nil || n <= 0 {
+			return
+		}
+	}
+}
+
+// pollSubvolumes reports changes by comparing subvolume listings. Failed listings
+// are logged once and retried with a growing interval, e.g. while a device is busy.
+func pollSubvolumes(path string, changed func()) error {
+	var last string
+	listed := false
+	interval := changePollInterval
+	var lastErr error
+	for {
+		subvolumes, err := ListSubvolumes(path)
+		if err != nil {
+			if lastErr == nil {
+				logOperation("list subvolumes of "+path+" to detect changes", err)
+			}
+			lastErr = err
+			interval = min(interval*2, maxChangePollInterval)
+			time.Sleep(interval)
+			continue
+		}
+		if lastErr != nil {
+			logOperation("list subvolumes of "+path+" to detect changes", nil)
+			lastErr = nil
+		}
+		interval = changePollInterval
+
+		current := subvolumeSignature(subvolumes)
+		if listed && current != last {
+			changed()
+		}
+		last, listed = current, true
+		time.Sleep(interval)
+	}
+}
+
+// subvolumeSignature identifies a set of subvolumes, ignoring their generations
+func subvolumeSignature(subvolumes []Subvolume) string {
+	var b strings.Builder
+	for _, subvolume := range subvolumes {
+		fmt.Fprintf(&b, "%d %s\n", subvolume.ID, subvolume.Path)
+	}
+	return b.String()
+}